@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// bookmarkRecord is a single bookmark as it is exported
+// and imported, it is also the json export format
+type bookmarkRecord struct {
+	Title  string   `json:"title"`
+	Url    string   `json:"url"`
+	Folder string   `json:"folder,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Note   string   `json:"note,omitempty"`
+}
+
+// BookmarkFormats lists the formats that bookmarks can be
+// exported to and imported from, with their file extension
+var BookmarkFormats = map[string]string{
+	"gemtext":   "gmi",
+	"gophermap": "gph",
+	"html":      "html",
+	"json":      "json",
+}
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Export returns the bookmarks in the given format: gemtext,
+// gophermap, html (the Netscape bookmark file format used by
+// most browsers) or json
+func (b Bookmarks) Export(format string) (string, error) {
+	records := b.records()
+	switch format {
+	case "gemtext":
+		return exportGemtext(records), nil
+	case "gophermap":
+		return exportGophermap(records), nil
+	case "html":
+		return exportNetscape(records), nil
+	case "json":
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	return "", fmt.Errorf("Unknown bookmark format %q, use gemtext, gophermap, html or json", format)
+}
+
+// Import adds the bookmarks in data, which is in the given
+// format, skipping any whose url is already bookmarked, in any
+// of the ways it can be written. It
+// returns the number of bookmarks added and skipped.
+func (b *Bookmarks) Import(format, data string) (int, int, error) {
+	var records []bookmarkRecord
+	switch format {
+	case "gemtext":
+		records = importGemtext(data)
+	case "gophermap":
+		records = importGophermap(data)
+	case "html":
+		records = importNetscape(data)
+	case "json":
+		err := json.Unmarshal([]byte(data), &records)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to read json bookmarks: %s", err.Error())
+		}
+	default:
+		return 0, 0, fmt.Errorf("Unknown bookmark format %q, use gemtext, gophermap, html or json", format)
+	}
+
+	known := make(map[string]bool, len(b.Links))
+	for _, link := range b.Links {
+		known[bookmarkKey(link)] = true
+	}
+	added, skipped := 0, 0
+	for _, r := range records {
+		r.Url = strings.TrimSpace(r.Url)
+		key := bookmarkKey(r.Url)
+		if r.Url == "" || known[key] {
+			skipped++
+			continue
+		}
+		known[key] = true
+		title := strings.TrimSpace(r.Title)
+		if title == "" {
+			title = r.Url
+		}
+		// Titles are ini keys, so may not contain the
+		// characters the ini file uses to mark out sections
+		// and values
+		title = strings.NewReplacer("[", "(", "]", ")", "=", "-", "\n", " ").Replace(title)
+		link := strings.Replace(r.Url, "\n", "", -1)
+		_, _ = b.Add([]string{link, title})
+		i := len(b.Links) - 1
+		b.Folders[i] = cleanFolder(r.Folder)
+		b.Tags[i] = cleanTags(r.Tags)
+		b.Notes[i] = strings.TrimSpace(r.Note)
+		added++
+	}
+	return added, skipped, nil
+}
+
+// records returns the bookmarks sorted by folder, keeping
+// their order within each folder
+func (b Bookmarks) records() []bookmarkRecord {
+	out := make([]bookmarkRecord, 0, len(b.Titles))
+	for i := range b.Titles {
+		out = append(out, bookmarkRecord{b.Titles[i], b.Links[i], b.Folders[i], b.Tags[i], b.Notes[i]})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Folder < out[j].Folder
+	})
+	return out
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// bookmarkKey returns the form of link used to find out
+// whether it is already bookmarked
+func bookmarkKey(link string) string {
+	u, err := MakeUrl(link)
+	if err != nil {
+		return link
+	}
+	return u.Full
+}
+
+func exportGemtext(records []bookmarkRecord) string {
+	var out strings.Builder
+	out.WriteString("# Bookmarks\n")
+	folder := ""
+	for i, r := range records {
+		if i == 0 || r.Folder != folder {
+			folder = r.Folder
+			if folder != "" {
+				out.WriteString("\n## " + folder + "\n")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(fmt.Sprintf("=> %s %s\n", r.Url, r.Title))
+		if len(r.Tags) > 0 {
+			out.WriteString("Tags: " + strings.Join(r.Tags, ", ") + "\n")
+		}
+		if r.Note != "" {
+			// Notes are quoted so that they cannot be read as
+			// a link, heading or anything else
+			out.WriteString("> " + strings.Replace(r.Note, "\n", " ", -1) + "\n")
+		}
+	}
+	return out.String()
+}
+
+func importGemtext(data string) []bookmarkRecord {
+	records := make([]bookmarkRecord, 0, 10)
+	folder := ""
+	// Text directly below a link holds its tags and note,
+	// as written by exportGemtext
+	afterLink := false
+	for _, ln := range strings.Split(data, "\n") {
+		ln = strings.TrimRight(ln, "\r")
+		if strings.HasPrefix(ln, "##") {
+			folder = strings.TrimSpace(strings.TrimLeft(ln, "#"))
+			afterLink = false
+			continue
+		} else if !strings.HasPrefix(ln, "=>") {
+			if !afterLink || strings.TrimSpace(ln) == "" || strings.HasPrefix(ln, "#") {
+				afterLink = false
+			} else if last := &records[len(records)-1]; strings.HasPrefix(ln, "Tags: ") && len(last.Tags) == 0 && last.Note == "" {
+				last.Tags = strings.Split(ln[6:], ",")
+			} else {
+				last.Note = strings.TrimSpace(last.Note + " " + strings.TrimPrefix(ln, ">"))
+			}
+			continue
+		}
+		fields := strings.Fields(ln[2:])
+		if len(fields) == 0 || !strings.Contains(fields[0], "://") {
+			// Relative links cannot be resolved without
+			// knowing where the document came from
+			afterLink = false
+			continue
+		}
+		records = append(records, bookmarkRecord{strings.Join(fields[1:], " "), fields[0], folder, nil, ""})
+		afterLink = true
+	}
+	return records
+}
+
+func exportGophermap(records []bookmarkRecord) string {
+	var out strings.Builder
+	info := func(text string) {
+		out.WriteString(fmt.Sprintf("i%s\t\terror.host\t1\r\n", text))
+	}
+	info("Bookmarks")
+	folder := ""
+	for i, r := range records {
+		if i == 0 || r.Folder != folder {
+			folder = r.Folder
+			info("")
+			if folder != "" {
+				info(folder)
+				info("")
+			}
+		}
+		out.WriteString(gophermapLine(r))
+		if r.Note != "" {
+			info("  " + r.Note)
+		}
+	}
+	out.WriteString(".\r\n")
+	return out.String()
+}
+
+// gophermapLine returns the gophermap item for a bookmark.
+// Gopher urls link directly to their item, anything else
+// uses the 'URL:' selector convention.
+func gophermapLine(r bookmarkRecord) string {
+	title := strings.Replace(r.Title, "\t", " ", -1)
+	u, err := MakeUrl(r.Url)
+	if err == nil && u.Scheme == "gopher" {
+		return fmt.Sprintf("%s%s\t%s\t%s\t%s\r\n", u.Mime, title, u.Resource, u.Host, u.Port)
+	}
+	return fmt.Sprintf("h%s\tURL:%s\terror.host\t1\r\n", title, r.Url)
+}
+
+func importGophermap(data string) []bookmarkRecord {
+	records := make([]bookmarkRecord, 0, 10)
+	for _, ln := range strings.Split(data, "\n") {
+		ln = strings.TrimRight(ln, "\r")
+		fields := strings.Split(ln, "\t")
+		if len(ln) < 2 || len(fields) < 4 || ln[0] == 'i' || ln[0] == '3' {
+			continue
+		}
+		title := fields[0][1:]
+		if strings.HasPrefix(fields[1], "URL:") {
+			records = append(records, bookmarkRecord{title, fields[1][4:], "", nil, ""})
+			continue
+		}
+		host, port := strings.TrimSpace(fields[2]), strings.TrimSpace(fields[3])
+		if host == "" {
+			continue
+		}
+		if port == "" {
+			port = "70"
+		}
+		link := fmt.Sprintf("gopher://%s/%c%s", net.JoinHostPort(host, port), ln[0], fields[1])
+		records = append(records, bookmarkRecord{title, link, "", nil, ""})
+	}
+	return records
+}
+
+func exportNetscape(records []bookmarkRecord) string {
+	var out strings.Builder
+	out.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n")
+	out.WriteString("<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=UTF-8\">\n")
+	out.WriteString("<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+
+	// Folders are nested lists, open and close them as the
+	// folder of each bookmark changes
+	open := []string{}
+	for _, r := range records {
+		var path []string
+		if r.Folder != "" {
+			path = strings.Split(r.Folder, "/")
+		}
+		common := 0
+		for common < len(open) && common < len(path) && open[common] == path[common] {
+			common++
+		}
+		for len(open) > common {
+			open = open[:len(open)-1]
+			out.WriteString(strings.Repeat("    ", len(open)+1) + "</DL><p>\n")
+		}
+		for _, name := range path[common:] {
+			indent := strings.Repeat("    ", len(open)+1)
+			out.WriteString(fmt.Sprintf("%s<DT><H3>%s</H3>\n%s<DL><p>\n", indent, html.EscapeString(name), indent))
+			open = append(open, name)
+		}
+		indent := strings.Repeat("    ", len(open)+1)
+		tags := ""
+		if len(r.Tags) > 0 {
+			tags = fmt.Sprintf(" TAGS=\"%s\"", html.EscapeString(strings.Join(r.Tags, ",")))
+		}
+		out.WriteString(fmt.Sprintf("%s<DT><A HREF=\"%s\"%s>%s</A>\n", indent, html.EscapeString(r.Url), tags, html.EscapeString(r.Title)))
+		if r.Note != "" {
+			out.WriteString(fmt.Sprintf("%s<DD>%s\n", indent, html.EscapeString(r.Note)))
+		}
+	}
+	for len(open) > 0 {
+		open = open[:len(open)-1]
+		out.WriteString(strings.Repeat("    ", len(open)+1) + "</DL><p>\n")
+	}
+	out.WriteString("</DL><p>\n")
+	return out.String()
+}
+
+var netscapeToken = regexp.MustCompile(`(?is)<h3[^>]*>(.*?)</h3>|<a\s([^>]*)>(.*?)</a>|<dd>([^<]*)|<dl[^>]*>|</dl>`)
+var netscapeAttr = regexp.MustCompile(`(?is)(\w+)\s*=\s*"([^"]*)"`)
+
+func importNetscape(data string) []bookmarkRecord {
+	records := make([]bookmarkRecord, 0, 10)
+	folders := []string{}
+	pending := ""
+	for _, m := range netscapeToken.FindAllStringSubmatch(data, -1) {
+		lower := strings.ToLower(m[0])
+		switch {
+		case strings.HasPrefix(lower, "<h3"):
+			pending = strings.TrimSpace(html.UnescapeString(m[1]))
+		case strings.HasPrefix(lower, "<dl"):
+			// The outermost list is not a folder
+			if pending != "" || len(folders) > 0 || len(records) > 0 {
+				folders = append(folders, strings.Replace(pending, "/", "-", -1))
+			}
+			pending = ""
+		case strings.HasPrefix(lower, "</dl"):
+			if len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+			}
+		case strings.HasPrefix(lower, "<a"):
+			r := bookmarkRecord{Title: strings.TrimSpace(html.UnescapeString(m[3]))}
+			for _, attr := range netscapeAttr.FindAllStringSubmatch(m[2], -1) {
+				switch strings.ToLower(attr[1]) {
+				case "href":
+					r.Url = html.UnescapeString(attr[2])
+				case "tags":
+					r.Tags = strings.Split(html.UnescapeString(attr[2]), ",")
+				}
+			}
+			if _, err := url.Parse(r.Url); err != nil || !strings.Contains(r.Url, "://") {
+				continue
+			}
+			r.Folder = strings.Join(folders, "/")
+			records = append(records, r)
+		case strings.HasPrefix(lower, "<dd"):
+			if len(records) > 0 {
+				records[len(records)-1].Note = strings.TrimSpace(html.UnescapeString(m[4]))
+			}
+		}
+	}
+	return records
+}
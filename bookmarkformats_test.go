@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Bookmarks_Export_Import_Round_Trip(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		expects []bookmarkRecord
+	}{
+		{
+			"Gemtext keeps folders, tags and notes",
+			"gemtext",
+			[]bookmarkRecord{
+				{"Floodgap", "gopher://gopher.floodgap.com:70/1/", "", []string{"gopher", "search"}, "=> not a link"},
+				{"Local", "gemini://[::1]:1965/", "", nil, ""},
+				{"Station", "gemini://station.martinrue.com:1965/", "social", nil, "# not a heading"},
+				{"Tags line", "gemini://example.org:1965/", "social/more", nil, "Tags: not tags"},
+			},
+		},
+		{
+			"Html keeps folders, tags and notes",
+			"html",
+			[]bookmarkRecord{
+				{"Floodgap", "gopher://gopher.floodgap.com:70/1/", "", []string{"gopher", "search"}, "=> not a link"},
+				{"Local", "gemini://[::1]:1965/", "", nil, ""},
+				{"Station", "gemini://station.martinrue.com:1965/", "social", nil, "# not a heading"},
+				{"Tags line", "gemini://example.org:1965/", "social/more", nil, "Tags: not tags"},
+			},
+		},
+		{
+			"Json keeps folders, tags and notes",
+			"json",
+			[]bookmarkRecord{
+				{"Floodgap", "gopher://gopher.floodgap.com:70/1/", "", []string{"gopher", "search"}, "=> not a link"},
+				{"Local", "gemini://[::1]:1965/", "", nil, ""},
+				{"Station", "gemini://station.martinrue.com:1965/", "social", nil, "# not a heading"},
+				{"Tags line", "gemini://example.org:1965/", "social/more", nil, "Tags: not tags"},
+			},
+		},
+		{
+			"Gophermap keeps titles and urls",
+			"gophermap",
+			[]bookmarkRecord{
+				{"Floodgap", "gopher://gopher.floodgap.com:70/1/", "", nil, ""},
+				{"Local", "gemini://[::1]:1965/", "", nil, ""},
+				{"Station", "gemini://station.martinrue.com:1965/", "", nil, ""},
+				{"Tags line", "gemini://example.org:1965/", "", nil, ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBookmarks()
+			data, err := b.Export(tt.format)
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s", tt.name, err)
+			}
+			imported := MakeBookmarks()
+			added, skipped, err := imported.Import(tt.format, data)
+			if err != nil || added != 4 || skipped != 0 {
+				t.Fatalf("Test failed - %s\nexpects 4 added, 0 skipped\nactual  %d added, %d skipped, error %v", tt.name, added, skipped, err)
+			}
+			actual := imported.records()
+			for i := range actual {
+				if len(actual[i].Tags) == 0 {
+					actual[i].Tags = nil
+				}
+			}
+			if !reflect.DeepEqual(actual, tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %v\nactual  %v", tt.name, tt.expects, actual)
+			}
+		})
+	}
+}
+
+func Test_Bookmarks_Import_Skips_Known(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects int
+	}{
+		{"Same url", `[{"title": "A", "url": "gopher://gopher.floodgap.com:70/1/"}]`, 1},
+		{"Default port left out", `[{"title": "A", "url": "gopher://gopher.floodgap.com/1/"}]`, 1},
+		{"Scheme in upper case", `[{"title": "A", "url": "GOPHER://gopher.floodgap.com:70/1/"}]`, 1},
+		{"Repeated new url", `[{"title": "A", "url": "gemini://new.example/"}, {"title": "B", "url": "gemini://new.example:1965/"}]`, 1},
+		{"IPv6 host", `[{"title": "A", "url": "gemini://[::1]/"}]`, 1},
+		{"Different url", `[{"title": "A", "url": "gemini://example.org:1965/other"}]`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBookmarks()
+			_, skipped, err := b.Import("json", tt.input)
+			if err != nil || skipped != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %d skipped\nactual  %d skipped, error %v", tt.name, tt.expects, skipped, err)
+			}
+		})
+	}
+}
+
+// testBookmarks returns bookmarks in a few folders, with
+// notes that look like gemtext markup and an IPv6 host
+func testBookmarks() Bookmarks {
+	b := MakeBookmarks()
+	_, _ = b.Add([]string{"gopher://gopher.floodgap.com:70/1/", "Floodgap"})
+	_, _ = b.Add([]string{"gemini://station.martinrue.com:1965/", "Station"})
+	_, _ = b.Add([]string{"gemini://example.org:1965/", "Tags", "line"})
+	_, _ = b.Add([]string{"gemini://[::1]:1965/", "Local"})
+	b.Tags[0] = []string{"gopher", "search"}
+	b.Notes[0] = "=> not a link"
+	b.Folders[1] = "social"
+	b.Notes[1] = "# not a heading"
+	b.Folders[2] = "social/more"
+	b.Notes[2] = "Tags: not tags"
+	return b
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	"tildegit.org/sloum/bombadillo/config"
 	"tildegit.org/sloum/bombadillo/cui"
 )
 
@@ -13,7 +15,8 @@ import (
 
 // Bookmarks represents the contents of the bookmarks
 // bar, as well as its visibility, focus, and scroll
-// state.
+// state. Each bookmark may be filed in a folder, given
+// tags and a note. Folders are paths separated by '/'.
 type Bookmarks struct {
 	IsOpen    bool
 	IsFocused bool
@@ -21,8 +24,28 @@ type Bookmarks struct {
 	Length    int
 	Titles    []string
 	Links     []string
+	Folders   []string
+	Tags      [][]string
+	Notes     []string
+	Collapsed map[string]bool
+	Filter    string
+	Query     string
+	Selected  int
 }
 
+// bookmarkRow is a single row of the bookmarks bar, either
+// a bookmark or, when Index is -1, a folder
+type bookmarkRow struct {
+	Text   string
+	Index  int
+	Folder string
+}
+
+// Links are used as keys in the BOOKMARKMETA section, where
+// an '=' would end the key
+var metaKeyEscape = strings.NewReplacer("%", "%25", "=", "%3D")
+var metaKeyUnescape = strings.NewReplacer("%25", "%", "%3D", "=")
+
 //------------------------------------------------\\
 // + + +           R E C E I V E R S         + + + \\
 //--------------------------------------------------\\
@@ -34,21 +57,160 @@ func (b *Bookmarks) Add(v []string) (string, error) {
 	}
 	b.Titles = append(b.Titles, strings.Join(v[1:], " "))
 	b.Links = append(b.Links, v[0])
+	b.Folders = append(b.Folders, "")
+	b.Tags = append(b.Tags, []string{})
+	b.Notes = append(b.Notes, "")
 	b.Length = len(b.Titles)
 	return "Bookmark added successfully", nil
 }
 
 // Delete a bookmark from the bookmarks struct
 func (b *Bookmarks) Delete(i int) (string, error) {
-	if i < len(b.Titles) && len(b.Titles) == len(b.Links) {
+	if i >= 0 && i < len(b.Titles) && len(b.Titles) == len(b.Links) {
 		b.Titles = append(b.Titles[:i], b.Titles[i+1:]...)
 		b.Links = append(b.Links[:i], b.Links[i+1:]...)
+		b.Folders = append(b.Folders[:i], b.Folders[i+1:]...)
+		b.Tags = append(b.Tags[:i], b.Tags[i+1:]...)
+		b.Notes = append(b.Notes[:i], b.Notes[i+1:]...)
 		b.Length = len(b.Titles)
 		return "Bookmark deleted successfully", nil
 	}
 	return "", fmt.Errorf("Bookmark %d does not exist", i)
 }
 
+// Move files a bookmark in a folder, an empty folder (or
+// "/") moves it out of any folder
+func (b *Bookmarks) Move(i int, folder string) (string, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return "", fmt.Errorf("Bookmark %d does not exist", i)
+	}
+	b.Folders[i] = cleanFolder(folder)
+	if b.Folders[i] == "" {
+		return fmt.Sprintf("Bookmark %d moved out of any folder", i), nil
+	}
+	return fmt.Sprintf("Bookmark %d moved to %s/", i, b.Folders[i]), nil
+}
+
+// Rename changes the title of a bookmark
+func (b *Bookmarks) Rename(i int, title string) (string, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return "", fmt.Errorf("Bookmark %d does not exist", i)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fmt.Errorf("A bookmark needs a title")
+	}
+	b.Titles[i] = title
+	return fmt.Sprintf("Bookmark %d renamed to %q", i, title), nil
+}
+
+// Tag replaces the tags of a bookmark, no tags clears them
+func (b *Bookmarks) Tag(i int, tags []string) (string, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return "", fmt.Errorf("Bookmark %d does not exist", i)
+	}
+	b.Tags[i] = cleanTags(tags)
+	if len(b.Tags[i]) == 0 {
+		return fmt.Sprintf("Tags removed from bookmark %d", i), nil
+	}
+	return fmt.Sprintf("Bookmark %d tagged: %s", i, strings.Join(b.Tags[i], ", ")), nil
+}
+
+// Note sets the free-text note of a bookmark, an empty
+// note removes it
+func (b *Bookmarks) Note(i int, note string) (string, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return "", fmt.Errorf("Bookmark %d does not exist", i)
+	}
+	b.Notes[i] = strings.TrimSpace(note)
+	if b.Notes[i] == "" {
+		return fmt.Sprintf("Note removed from bookmark %d", i), nil
+	}
+	return fmt.Sprintf("Note added to bookmark %d", i), nil
+}
+
+// Info returns a description of a bookmark, including its
+// folder, tags and note
+func (b *Bookmarks) Info(i int) (string, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return "", fmt.Errorf("Bookmark %d does not exist", i)
+	}
+	info := fmt.Sprintf("[%d] %s (%s)", i, b.Titles[i], b.Links[i])
+	if b.Folders[i] != "" {
+		info += fmt.Sprintf(" in %s/", b.Folders[i])
+	}
+	if len(b.Tags[i]) > 0 {
+		info += fmt.Sprintf(" tags: %s", strings.Join(b.Tags[i], ", "))
+	}
+	if b.Notes[i] != "" {
+		info += fmt.Sprintf(" note: %s", b.Notes[i])
+	}
+	return info, nil
+}
+
+// ToggleFolder expands or collapses a folder in the
+// bookmarks bar
+func (b *Bookmarks) ToggleFolder(folder string) (string, error) {
+	folder = cleanFolder(folder)
+	found := false
+	for _, f := range b.Folders {
+		if f == folder || strings.HasPrefix(f, folder+"/") {
+			found = true
+			break
+		}
+	}
+	if folder == "" || !found {
+		return "", fmt.Errorf("There is no bookmark folder %q", folder)
+	}
+	b.Collapsed[folder] = !b.Collapsed[folder]
+	if b.Collapsed[folder] {
+		return fmt.Sprintf("Collapsed %s/", folder), nil
+	}
+	return fmt.Sprintf("Expanded %s/", folder), nil
+}
+
+// SetFilter limits the bookmarks bar to bookmarks with
+// the given tag, an empty tag removes the filter
+func (b *Bookmarks) SetFilter(tag string) string {
+	b.Filter = strings.ToLower(strings.TrimSpace(tag))
+	b.Position = 0
+	if b.Filter == "" {
+		return "Showing all bookmarks"
+	}
+	return fmt.Sprintf("Showing bookmarks tagged %q", b.Filter)
+}
+
+// SetMeta sets the folder, tags and note of the bookmarks for
+// the link stored under key in the BOOKMARKMETA section of the
+// ini file. The value is in the format: folder|tag,tag|note
+func (b *Bookmarks) SetMeta(key, meta string) {
+	link := metaKeyUnescape.Replace(key)
+	fields := strings.SplitN(meta, "|", 3)
+	for i := range b.Links {
+		if b.Links[i] != link {
+			continue
+		}
+		b.Folders[i] = cleanFolder(fields[0])
+		if len(fields) > 1 {
+			b.Tags[i] = cleanTags(strings.Split(fields[1], ","))
+		}
+		if len(fields) > 2 {
+			b.Notes[i] = strings.TrimSpace(fields[2])
+		}
+	}
+}
+
+// LoadIni adds the bookmarks read from .bombadillo.ini, along
+// with their folders, tags and notes
+func (b *Bookmarks) LoadIni(settings config.Config) {
+	for i, v := range settings.Bookmarks.Titles {
+		_, _ = b.Add([]string{v, settings.Bookmarks.Links[i]})
+	}
+	for _, v := range settings.BookmarkMeta {
+		b.SetMeta(v.Key, v.Value)
+	}
+}
+
 // ToggleOpen toggles visibility state of the bookmarks bar
 func (b *Bookmarks) ToggleOpen() {
 	b.IsOpen = !b.IsOpen
@@ -79,22 +241,195 @@ func (b Bookmarks) IniDump() string {
 		out += b.Links[i]
 		out += "\n"
 	}
+
+	// Folders, tags and notes are kept in their own section,
+	// keyed by link, so that older versions can still read
+	// the bookmarks themselves
+	meta := ""
+	for i := 0; i < len(b.Titles); i++ {
+		if b.Folders[i] == "" && len(b.Tags[i]) == 0 && b.Notes[i] == "" {
+			continue
+		}
+		note := strings.NewReplacer("[", "(", "]", ")", "\n", " ").Replace(b.Notes[i])
+		meta += fmt.Sprintf("%s=%s|%s|%s\n", metaKeyEscape.Replace(b.Links[i]), b.Folders[i], strings.Join(b.Tags[i], ","), note)
+	}
+	if meta != "" {
+		out += "[BOOKMARKMETA]\n" + meta
+	}
 	return out
 }
 
 // List returns a list, including link nums, of bookmarks
-// as a string slice
+// as a string slice. Bookmarks are listed within their
+// folders, the contents of collapsed folders are hidden.
+// While there is a query only the matching bookmarks are
+// listed, best match first.
 func (b Bookmarks) List() []string {
-	var out []string
-	for i, t := range b.Titles {
-		out = append(out, fmt.Sprintf("[%d] %s", i, t))
+	rows := b.rows()
+	out := make([]string, len(rows))
+	for i, r := range rows {
+		out[i] = r.Text
+	}
+	return out
+}
+
+// Select moves the selection to the given row, keeping it
+// within a bookmarks bar that shows height rows
+func (b *Bookmarks) Select(row, height int) {
+	rows := len(b.rows())
+	if row >= rows {
+		row = rows - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+	b.Selected = row
+	if height < 1 {
+		height = 1
+	}
+	if b.Position > row {
+		b.Position = row
+	} else if b.Position <= row-height {
+		b.Position = row - height + 1
+	}
+}
+
+// SelectedRow returns the row of the bookmarks bar that
+// is selected
+func (b Bookmarks) SelectedRow() (bookmarkRow, bool) {
+	rows := b.rows()
+	if b.Selected < 0 || b.Selected >= len(rows) {
+		return bookmarkRow{}, false
+	}
+	return rows[b.Selected], true
+}
+
+// SetQuery sets the text that bookmarks are fuzzy matched
+// against and selects the best match
+func (b *Bookmarks) SetQuery(query string) {
+	b.Query = query
+	b.Selected = 0
+	b.Position = 0
+}
+
+// Shift moves bookmark i up (dir -1) or down (dir 1) past
+// the next bookmark shown in the same folder, returning its
+// new id
+func (b *Bookmarks) Shift(i, dir int) (int, error) {
+	if i < 0 || i >= len(b.Titles) {
+		return i, fmt.Errorf("There is no bookmark with ID %d", i)
+	}
+	for j := i + dir; j >= 0 && j < len(b.Titles); j += dir {
+		if b.Folders[j] != b.Folders[i] || (b.Filter != "" && !hasTag(b.Tags[j], b.Filter)) {
+			continue
+		}
+		b.Titles[i], b.Titles[j] = b.Titles[j], b.Titles[i]
+		b.Links[i], b.Links[j] = b.Links[j], b.Links[i]
+		b.Folders[i], b.Folders[j] = b.Folders[j], b.Folders[i]
+		b.Tags[i], b.Tags[j] = b.Tags[j], b.Tags[i]
+		b.Notes[i], b.Notes[j] = b.Notes[j], b.Notes[i]
+		return j, nil
+	}
+	if dir < 0 {
+		return i, fmt.Errorf("Bookmark %d is already at the top of its folder", i)
+	}
+	return i, fmt.Errorf("Bookmark %d is already at the bottom of its folder", i)
+}
+
+// SelectBookmark selects the row holding bookmark i
+func (b *Bookmarks) SelectBookmark(i, height int) {
+	for n, r := range b.rows() {
+		if r.Index == i {
+			b.Select(n, height)
+			return
+		}
+	}
+}
+
+func (b Bookmarks) rows() []bookmarkRow {
+	visible := make([]int, 0, len(b.Titles))
+	for i := range b.Titles {
+		if b.Filter == "" || hasTag(b.Tags[i], b.Filter) {
+			visible = append(visible, i)
+		}
+	}
+	if b.Query != "" {
+		return b.matches(visible)
+	}
+
+	// Every folder holding a visible bookmark, along with
+	// the folders it is nested in, gets a row
+	folders := make(map[string]bool)
+	for _, i := range visible {
+		for f := b.Folders[i]; f != ""; f = parentFolder(f) {
+			folders[f] = true
+		}
+	}
+
+	var out []bookmarkRow
+	var list func(parent string, depth int)
+	list = func(parent string, depth int) {
+		indent := strings.Repeat("  ", depth)
+		children := make([]string, 0)
+		for f := range folders {
+			if parentFolder(f) == parent {
+				children = append(children, f)
+			}
+		}
+		sort.Strings(children)
+		for _, f := range children {
+			name := f[strings.LastIndex(f, "/")+1:]
+			if b.Collapsed[f] {
+				out = append(out, bookmarkRow{fmt.Sprintf("%s▸ %s/", indent, name), -1, f})
+				continue
+			}
+			out = append(out, bookmarkRow{fmt.Sprintf("%s▾ %s/", indent, name), -1, f})
+			list(f, depth+1)
+		}
+		for _, i := range visible {
+			if b.Folders[i] == parent {
+				out = append(out, bookmarkRow{fmt.Sprintf("%s[%d] %s", indent, i, b.Titles[i]), i, parent})
+			}
+		}
+	}
+	list("", 0)
+	return out
+}
+
+// matches returns a row for each of the given bookmarks whose
+// title or url fuzzy matches the query, best match first
+func (b Bookmarks) matches(candidates []int) []bookmarkRow {
+	type match struct {
+		index int
+		score int
+	}
+	found := make([]match, 0, len(candidates))
+	for _, i := range candidates {
+		score, ok := fuzzyScore(b.Query, b.Titles[i])
+		// Titles are what the user sees, so a match there
+		// ranks above an equally good match on the url
+		score *= 2
+		if urlScore, urlOk := fuzzyScore(b.Query, b.Links[i]); urlOk && (!ok || urlScore > score) {
+			score, ok = urlScore, true
+		}
+		if ok {
+			found = append(found, match{i, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score > found[j].score
+	})
+	out := make([]bookmarkRow, len(found))
+	for n, m := range found {
+		out[n] = bookmarkRow{fmt.Sprintf("[%d] %s", m.index, b.Titles[m.index]), m.index, b.Folders[m.index]}
 	}
 	return out
 }
 
 // Render returns a string slice with the contents of each
-// visual row of the bookmark bar.
-func (b Bookmarks) Render(termwidth, termheight int) []string {
+// visual row of the bookmark bar. While the bar is focused
+// the selected row is highlighted.
+func (b Bookmarks) Render(termwidth, termheight int, theme string) []string {
 	width := 40
 	termheight -= 3
 	var walll, wallr, floor, ceil, tr, tl, br, bl string
@@ -124,11 +459,25 @@ func (b Bookmarks) Render(termwidth, termheight int) []string {
 	out := make([]string, 0, 5)
 	contentWidth := width - 2
 	top := fmt.Sprintf("%s%s%s", tl, strings.Repeat(ceil, contentWidth), tr)
+	if b.Query != "" {
+		// The query is shown in the top of the bar
+		label := []rune(fmt.Sprintf(" /%s ", b.Query))
+		if len(label) > contentWidth {
+			label = label[len(label)-contentWidth:]
+		}
+		top = fmt.Sprintf("%s%s%s%s", tl, string(label), strings.Repeat(ceil, contentWidth-len(label)), tr)
+	}
 	out = append(out, top)
+	highlight, unhighlight := "\033[7m", "\033[27m"
+	if theme == "inverse" {
+		highlight, unhighlight = unhighlight, highlight
+	}
 	marks := b.List()
 	for i := 0; i < termheight-2; i++ {
-		if i+b.Position >= len(b.Titles) {
+		if i+b.Position >= len(marks) {
 			out = append(out, fmt.Sprintf("%s%-*.*s%s", walll, contentWidth, contentWidth, "", wallr))
+		} else if b.IsFocused && i+b.Position == b.Selected {
+			out = append(out, fmt.Sprintf("%s%s%-*.*s%s%s", walll, highlight, contentWidth, contentWidth, marks[i+b.Position], unhighlight, wallr))
 		} else {
 			out = append(out, fmt.Sprintf("%s%-*.*s%s", walll, contentWidth, contentWidth, marks[i+b.Position], wallr))
 		}
@@ -145,5 +494,83 @@ func (b Bookmarks) Render(termwidth, termheight int) []string {
 
 // MakeBookmarks creates a Bookmark struct with default values
 func MakeBookmarks() Bookmarks {
-	return Bookmarks{false, false, 0, 0, make([]string, 0), make([]string, 0)}
+	return Bookmarks{false, false, 0, 0, make([]string, 0), make([]string, 0), make([]string, 0), make([][]string, 0), make([]string, 0), make(map[string]bool), "", "", 0}
+}
+
+// cleanFolder normalizes a folder path, removing empty
+// parts and characters that the ini file cannot hold
+func cleanFolder(folder string) string {
+	folder = strings.NewReplacer("|", "", "[", "", "]", "").Replace(folder)
+	parts := make([]string, 0, 3)
+	for _, p := range strings.Split(folder, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func parentFolder(folder string) string {
+	if i := strings.LastIndex(folder, "/"); i >= 0 {
+		return folder[:i]
+	}
+	return ""
+}
+
+// cleanTags lowercases tags and removes duplicates and
+// characters that the ini file cannot hold
+func cleanTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	clean := strings.NewReplacer("|", "", ",", "", "[", "", "]", "")
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(clean.Replace(t)))
+		if t != "" && !hasTag(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// fuzzyScore reports whether the characters of query appear
+// in text in order, ignoring case, and scores the match. Runs
+// of consecutive characters and matches at the start of words
+// score highest, gaps between matches lower the score.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+	score, qi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if last >= 0 && ti == last+1 {
+			score += 5
+		} else if gap := ti - last - 1; last >= 0 && gap > 3 {
+			score -= 3
+		} else if last >= 0 {
+			score -= gap
+		}
+		if ti == 0 || strings.ContainsRune(" /._-:[(", t[ti-1]) {
+			score += 3
+		}
+		last = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"tildegit.org/sloum/bombadillo/config"
+)
+
+func Test_Bookmarks_Meta_Round_Trip(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string
+		folder  string
+		tags    []string
+		note    string
+		expects string
+	}{
+		{
+			"Plain link",
+			"gopher://example.org:70/1/",
+			"phlogs/friends",
+			[]string{"daily"},
+			"A note",
+			"phlogs/friends|daily|A note",
+		},
+		{
+			"Link holding '=' and '%'",
+			"gemini://example.org:1965/search?q=a%20b",
+			"search",
+			[]string{},
+			"",
+			"search||",
+		},
+		{
+			"Link with an IPv6 host",
+			"gemini://[::1]:1965/",
+			"local",
+			[]string{"x", "y"},
+			"",
+			"local|x,y|",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := MakeBookmarks()
+			_, _ = b.Add([]string{"gemini://other.example:1965/", "Other"})
+			_, _ = b.Add([]string{tt.link, "Title"})
+			b.Folders[1] = tt.folder
+			b.Tags[1] = tt.tags
+			b.Notes[1] = tt.note
+
+			settings, err := config.NewParser(strings.NewReader(b.IniDump())).Parse()
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s", tt.name, err)
+			}
+			loaded := MakeBookmarks()
+			loaded.LoadIni(settings)
+
+			if len(loaded.Links) != 2 || loaded.Links[1] != tt.link {
+				t.Fatalf("Test failed - %s\nexpects %s\nactual  %v", tt.name, tt.link, loaded.Links)
+			}
+			actual := loaded.Folders[1] + "|" + strings.Join(loaded.Tags[1], ",") + "|" + loaded.Notes[1]
+			if actual != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %s", tt.name, tt.expects, actual)
+			}
+			other := []string{loaded.Folders[0], loaded.Notes[0]}
+			if !reflect.DeepEqual(other, []string{"", ""}) {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %s", tt.name, "no metadata on the other bookmark", other)
+			}
+		})
+	}
+}
+
+func Test_fuzzyScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		text    string
+		score   int
+		matches bool
+	}{
+		{"Empty query matches anything", "", "Floodgap", 0, true},
+		{"Run of characters at the start", "flood", "Floodgap", 28, true},
+		{"Run of characters inside a word", "gap", "Floodgap", 13, true},
+		{"Wide gap between characters", "fg", "Floodgap", 2, true},
+		{"Start of a later word", "ms", "my site", 6, true},
+		{"Characters out of order", "pg", "Floodgap", 0, false},
+		{"Characters missing", "xyz", "Floodgap", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, matches := fuzzyScore(tt.query, tt.text)
+			if score != tt.score || matches != tt.matches {
+				t.Errorf("Test failed - %s\nexpects %d %t\nactual  %d %t", tt.name, tt.score, tt.matches, score, matches)
+			}
+		})
+	}
+}
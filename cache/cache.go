@@ -0,0 +1,245 @@
+// Package cache provides an on-disk cache of responses, keyed
+// by url, with an expiry time and a size cap. When the cache
+// grows beyond its cap the least recently used responses are
+// evicted.
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// Cache stores responses in a directory, one file per url.
+// Each file starts with a line holding the time the response
+// was stored and its url. The modification time of the file
+// is updated whenever it is read, so that it records when the
+// response was last used.
+type Cache struct {
+	TTL     time.Duration
+	MaxSize int64
+	dir     string
+	hits    int
+	misses  int
+	lock    sync.Mutex
+}
+
+// Stats describes the contents of a Cache
+type Stats struct {
+	Entries int
+	Size    int64
+	Hits    int
+	Misses  int
+}
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// SetDir sets the directory the cache is kept in. It will be
+// created when the first response is stored.
+func (c *Cache) SetDir(dir string) {
+	c.dir = dir
+}
+
+// Enabled reports whether responses will be stored
+func (c *Cache) Enabled() bool {
+	return c.dir != "" && c.TTL > 0
+}
+
+// Get returns the response stored for key, along with the time
+// it was stored. Responses older than the TTL are ignored
+// unless stale is true.
+func (c *Cache) Get(key string, stale bool) ([]byte, time.Time, bool) {
+	if c.dir == "" {
+		return nil, time.Time{}, false
+	}
+	path := c.path(key)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		c.count(false)
+		return nil, time.Time{}, false
+	}
+	stored, storedKey, body, err := split(data)
+	if err != nil || storedKey != key || (!stale && time.Since(stored) > c.TTL) {
+		c.count(false)
+		return nil, time.Time{}, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.count(true)
+	return body, stored, true
+}
+
+// Put stores the response for key, evicting the least recently
+// used responses if the cache has grown beyond MaxSize
+func (c *Cache) Put(key string, data []byte) error {
+	if !c.Enabled() {
+		return nil
+	}
+	header := fmt.Sprintf("%d\t%s\n", time.Now().Unix(), key)
+	if c.MaxSize > 0 && int64(len(header)+len(data)) > c.MaxSize {
+		return nil
+	}
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(header) + len(data))
+	buf.WriteString(header)
+	buf.Write(data)
+	err = ioutil.WriteFile(c.path(key), buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return c.evict()
+}
+
+// Delete removes the response stored for key, if there is one
+func (c *Cache) Delete(key string) error {
+	if c.dir == "" {
+		return nil
+	}
+	err := os.Remove(c.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Purge removes every response from the cache
+func (c *Cache) Purge() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		err = os.Remove(filepath.Join(c.dir, f.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	c.lock.Lock()
+	c.hits = 0
+	c.misses = 0
+	c.lock.Unlock()
+	return nil
+}
+
+// Stats returns the number of responses in the cache, their
+// total size, and the hits and misses since the cache was made
+func (c *Cache) Stats() (Stats, error) {
+	c.lock.Lock()
+	s := Stats{0, 0, c.hits, c.misses}
+	c.lock.Unlock()
+	files, err := c.files()
+	if err != nil {
+		return s, err
+	}
+	for _, f := range files {
+		s.Entries++
+		s.Size += f.Size()
+	}
+	return s, nil
+}
+
+func (c *Cache) count(hit bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+func (c *Cache) evict() error {
+	if c.MaxSize < 1 {
+		return nil
+	}
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, f := range files {
+		if total <= c.MaxSize {
+			break
+		}
+		err = os.Remove(filepath.Join(c.dir, f.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.Size()
+	}
+	return nil
+}
+
+func (c *Cache) files() ([]os.FileInfo, error) {
+	if c.dir == "" {
+		return []os.FileInfo{}, nil
+	}
+	infos, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return []os.FileInfo{}, nil
+	} else if err != nil {
+		return []os.FileInfo{}, err
+	}
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, f := range infos {
+		if f.Mode().IsRegular() {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+func split(data []byte) (time.Time, string, []byte, error) {
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 {
+		return time.Time{}, "", nil, fmt.Errorf("Malformed cache entry")
+	}
+	tab := bytes.IndexByte(data[:nl], '\t')
+	if tab < 0 {
+		return time.Time{}, "", nil, fmt.Errorf("Malformed cache entry")
+	}
+	ts, err := strconv.ParseInt(string(data[:tab]), 10, 64)
+	if err != nil {
+		return time.Time{}, "", nil, fmt.Errorf("Malformed cache entry")
+	}
+	return time.Unix(ts, 0), string(data[tab+1 : nl]), data[nl+1:], nil
+}
+
+// MakeCache returns a Cache with the given expiry time and
+// size cap, it must be given a directory before use
+func MakeCache(ttl time.Duration, maxSize int64) Cache {
+	return Cache{ttl, maxSize, "", 0, 0, sync.Mutex{}}
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Get_TTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		age     time.Duration
+		stale   bool
+		expects bool
+	}{
+		{"Fresh response is used", time.Minute, false, true},
+		{"Expired response is ignored", 2 * time.Hour, false, false},
+		{"Expired response is used when stale is allowed", 2 * time.Hour, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tempCache(t, time.Hour, 0)
+			defer os.RemoveAll(c.dir)
+			key := "gopher://example.org:70/1/"
+			writeEntry(t, c, key, "menu", time.Now().Add(-tt.age))
+
+			body, _, ok := c.Get(key, tt.stale)
+			if ok != tt.expects || (ok && string(body) != "menu") {
+				t.Errorf("Test failed - %s\nexpects %t\nactual  %t %q", tt.name, tt.expects, ok, body)
+			}
+		})
+	}
+}
+
+func Test_Cache_Put_Size(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		puts    []string
+		expects []bool
+	}{
+		{
+			"Responses within the size cap are kept",
+			1000,
+			[]string{"gemini://a.example:1965/", "gemini://b.example:1965/"},
+			[]bool{true, true},
+		},
+		{
+			"Least recently used response is evicted",
+			100,
+			[]string{"gemini://a.example:1965/", "gemini://b.example:1965/"},
+			[]bool{false, true},
+		},
+		{
+			"Response larger than the cap is not stored",
+			10,
+			[]string{"gemini://a.example:1965/"},
+			[]bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tempCache(t, time.Hour, tt.maxSize)
+			defer os.RemoveAll(c.dir)
+			for i, key := range tt.puts {
+				err := c.Put(key, make([]byte, 50))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Eviction goes by modification time, which
+				// is set here so the order does not depend on
+				// the resolution of the file system's clock
+				when := time.Now().Add(time.Duration(i-len(tt.puts)) * time.Minute)
+				_ = os.Chtimes(c.path(key), when, when)
+			}
+			_ = c.evict()
+			for i, key := range tt.puts {
+				_, _, ok := c.Get(key, false)
+				if ok != tt.expects[i] {
+					t.Errorf("Test failed - %s\nexpects %s stored %t\nactual  %t", tt.name, key, tt.expects[i], ok)
+				}
+			}
+		})
+	}
+}
+
+func Test_Cache_Stats_Purge(t *testing.T) {
+	c := tempCache(t, time.Hour, 0)
+	defer os.RemoveAll(c.dir)
+	_ = c.Put("finger://example.org:79/", []byte("plan"))
+	c.Get("finger://example.org:79/", false)
+	c.Get("finger://example.org:79/missing", false)
+
+	s, err := c.Stats()
+	if err != nil || s.Entries != 1 || s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %+v", "Stats counts entries, hits and misses", "1 entry, 1 hit, 1 miss", s)
+	}
+	err = c.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ = c.Stats()
+	if s.Entries != 0 || s.Hits != 0 || s.Misses != 0 {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %+v", "Purge empties the cache", "nothing", s)
+	}
+}
+
+func Test_Cache_Delete(t *testing.T) {
+	c := tempCache(t, time.Hour, 0)
+	defer os.RemoveAll(c.dir)
+	_ = c.Put("gemini://example.org:1965/", []byte("20 text/gemini\r\n"))
+	_ = c.Put("gemini://example.org:1965/other", []byte("20 text/gemini\r\n"))
+	err := c.Delete("gemini://example.org:1965/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Delete("gemini://example.org:1965/missing")
+	if err != nil {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %s", "Deleting a missing response", "no error", err)
+	}
+	_, _, deleted := c.Get("gemini://example.org:1965/", false)
+	_, _, kept := c.Get("gemini://example.org:1965/other", false)
+	if deleted || !kept {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  deleted stored %t, other stored %t", "Delete removes one response", "only the other stored", deleted, kept)
+	}
+}
+
+func Test_Cache_Disabled(t *testing.T) {
+	c := tempCache(t, 0, 0)
+	defer os.RemoveAll(c.dir)
+	_ = c.Put("gopher://example.org:70/1/", []byte("menu"))
+	if _, _, ok := c.Get("gopher://example.org:70/1/", true); ok {
+		t.Errorf("Test failed - %s\nexpects %t\nactual  %t", "A TTL of 0 stores nothing", false, ok)
+	}
+}
+
+// tempCache makes a cache in a new temporary directory
+func tempCache(t *testing.T, ttl time.Duration, maxSize int64) *Cache {
+	dir, err := ioutil.TempDir("", "bombadillo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := MakeCache(ttl, maxSize)
+	c.SetDir(dir)
+	return &c
+}
+
+// writeEntry stores a response as if it had been put at when
+func writeEntry(t *testing.T, c *Cache, key, body string, when time.Time) {
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("%d\t%s\n%s", when.Unix(), key, body)
+	err = ioutil.WriteFile(c.path(key), []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
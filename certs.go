@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"tildegit.org/sloum/bombadillo/gemini"
+)
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// renderCerts returns the certificate manager page, listing
+// each pinned host along with links to purge it, pin a
+// certificate accepted for this session, or view the chain
+// the host last presented. current is the host of the
+// capsule being viewed, its chain is offered first.
+func renderCerts(td *gemini.TofuDigest, current string) (string, []string) {
+	links := make([]string, 0, 10)
+	link := func(target, text string) string {
+		links = append(links, target)
+		return fmt.Sprintf("%-5s %s\n", fmt.Sprintf("[%d]", len(links)), text)
+	}
+	var out strings.Builder
+	out.WriteString("Pinned Certificates\n\n")
+	if _, ok := td.Chain(current); ok {
+		out.WriteString(link("about:certs/chain/"+current, fmt.Sprintf("View the certificate chain of %s", current)))
+		out.WriteString("\n")
+	}
+	hosts := td.Hosts()
+	if len(hosts) == 0 {
+		out.WriteString("No gemini certificates have been pinned\n")
+		return out.String(), links
+	}
+	for _, host := range hosts {
+		out.WriteString(host + "\n")
+		if cert, ok := td.Lookup(host); ok {
+			out.WriteString(describeCert(cert))
+			out.WriteString(link("about:certs/purge/"+host, "Purge"))
+		}
+		if cert, ok := td.Accepted(host); ok {
+			out.WriteString("      Accepted for this session only:\n")
+			out.WriteString(describeCert(cert))
+			out.WriteString(link("about:certs/pin/"+host, "Pin permanently"))
+		}
+		if _, ok := td.Chain(host); ok {
+			out.WriteString(link("about:certs/chain/"+host, "View certificate chain"))
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), links
+}
+
+// renderChain returns a page describing each certificate in
+// the chain that host last presented, followed by its PEM
+// encoding
+func renderChain(td *gemini.TofuDigest, host string) (string, error) {
+	chain, ok := td.Chain(host)
+	if !ok {
+		return "", fmt.Errorf("%q has not been visited since bombadillo started", host)
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Certificate Chain for %s\n\n", host))
+	for i, cert := range chain {
+		out.WriteString(fmt.Sprintf("Certificate %d of %d\n", i+1, len(chain)))
+		out.WriteString(fmt.Sprintf("      Subject: %s\n", cert.Subject.String()))
+		out.WriteString(fmt.Sprintf("      Issuer: %s\n", cert.Issuer.String()))
+		out.WriteString(fmt.Sprintf("      Serial: %X\n", cert.SerialNumber))
+		out.WriteString(fmt.Sprintf("      Valid: %s to %s\n", cert.NotBefore.Format("2006-01-02 15:04"), cert.NotAfter.Format("2006-01-02 15:04")))
+		if len(cert.DNSNames) > 0 {
+			out.WriteString(fmt.Sprintf("      Names: %s\n", strings.Join(cert.DNSNames, ", ")))
+		}
+		out.WriteString(fmt.Sprintf("      SHA-256: %s\n\n", gemini.Fingerprint(cert)))
+		out.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+func describeCert(cert gemini.CertInfo) string {
+	subject, seen := cert.Subject, "never"
+	if subject == "" {
+		subject = "unknown"
+	}
+	if !cert.LastSeen.IsZero() {
+		seen = cert.LastSeen.Format("2006-01-02 15:04")
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("      Fingerprint: %s\n", cert.Fingerprint))
+	out.WriteString(fmt.Sprintf("      Subject: %s\n", subject))
+	out.WriteString(fmt.Sprintf("      Expires: %s (%d)\n", cert.Expires.Format("2006-01-02 15:04"), cert.Expires.Unix()))
+	out.WriteString(fmt.Sprintf("      Last seen: %s\n", seen))
+	return out.String()
+}
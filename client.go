@@ -1,25 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"tildegit.org/sloum/bombadillo/cache"
 	"tildegit.org/sloum/bombadillo/cmdparse"
+	"tildegit.org/sloum/bombadillo/cso"
 	"tildegit.org/sloum/bombadillo/cui"
 	"tildegit.org/sloum/bombadillo/finger"
 	"tildegit.org/sloum/bombadillo/gemini"
 	"tildegit.org/sloum/bombadillo/gopher"
 	"tildegit.org/sloum/bombadillo/http"
+	"tildegit.org/sloum/bombadillo/idn"
 	"tildegit.org/sloum/bombadillo/local"
+	"tildegit.org/sloum/bombadillo/nex"
+	"tildegit.org/sloum/bombadillo/spartan"
+	"tildegit.org/sloum/bombadillo/stream"
 	"tildegit.org/sloum/bombadillo/telnet"
 	"tildegit.org/sloum/bombadillo/termios"
+	"tildegit.org/sloum/bombadillo/titan"
 )
 
 //------------------------------------------------\\
@@ -32,13 +48,33 @@ type client struct {
 	Options      map[string]string
 	Message      string
 	MessageIsErr bool
-	PageState    Pages
+	PageState    *Pages
+	Tabs         []*Pages
+	Tab          int
 	BookMarks    Bookmarks
 	TopBar       Headbar
 	FootBar      Footbar
 	Certs        gemini.TofuDigest
+	Identities   gemini.IdentityStore
+	History      HistoryStore
+	Session      string
+	Cache        cache.Cache
+	LinkCheck    LinkChecker
+	Searches     SearchStore
+	Engines      SearchEngines
+	redirects    []string
+	refresh      bool
+	cancelLoad   context.CancelFunc
+	loadLock     sync.Mutex
+	tasks        chan func()
 }
 
+var errLoadCancelled = errors.New("Page load cancelled")
+
+// aboutActions are the about: pages that carry out an action.
+// They are only followed from links on other about: pages.
+var aboutActions = []string{"linkcheck/", "certs/purge/", "certs/pin/", "searches/", "engines/"}
+
 //------------------------------------------------\\
 // + + +           R E C E I V E R S         + + + \\
 //--------------------------------------------------\\
@@ -80,7 +116,7 @@ func (c *client) Draw() {
 	}
 	re = regexp.MustCompile(`\033\[(?:\d*;?)+[A-Za-z]`)
 	if c.BookMarks.IsOpen {
-		bm := c.BookMarks.Render(c.Width, c.Height)
+		bm := c.BookMarks.Render(c.Width, c.Height, c.Options["theme"])
 		bmWidth := len([]rune(bm[0]))
 		for i := 0; i < c.Height-3; i++ {
 			if c.Width > bmWidth {
@@ -135,14 +171,22 @@ func (c *client) Draw() {
 	// TODO using message here breaks on resize, must regenerate
 	screen.WriteString(c.RenderMessage())
 	screen.WriteString("\n") // for the input line
-	screen.WriteString(c.FootBar.Render(c.Width, c.PageState.Position, c.Options["theme"]))
+	screen.WriteString(c.FootBar.Render(c.Width, c.PageState.Position, c.Tab, len(c.Tabs), c.Options["theme"]))
 	// cui.Clear("screen")
 	cui.MoveCursorTo(0, 0)
 	fmt.Print(screen.String())
 }
 
 func (c *client) TakeControlInput() {
-	input := cui.Getch()
+	input, ok := cui.GetchUnless(c.taskPending)
+	if !ok {
+		task := <-c.tasks
+		task()
+		return
+	}
+	if c.BookMarks.IsFocused && c.bookmarkInput(input) {
+		return
+	}
 
 	switch input {
 	case '1', '2', '3', '4', '5', '6', '7', '8', '9', '0':
@@ -161,7 +205,7 @@ func (c *client) TakeControlInput() {
 		c.Scroll(-1)
 	case 'q':
 		// quit bombadillo
-		cui.Exit(0, "")
+		c.Quit(0)
 	case 'g':
 		// scroll to top
 		c.ClearMessage()
@@ -201,6 +245,10 @@ func (c *client) TakeControlInput() {
 		} else {
 			c.Draw()
 		}
+	case 'i':
+		// show information about the current page
+		c.ClearMessage()
+		c.pageInfo()
 	case 'B':
 		// open the bookmarks browser
 		c.BookMarks.ToggleOpen()
@@ -217,6 +265,14 @@ func (c *client) TakeControlInput() {
 			c.SetPercentRead()
 			c.Draw()
 		}
+	case 't':
+		// switch to the next tab
+		c.ClearMessage()
+		c.SwitchTab((c.Tab + 1) % len(c.Tabs))
+	case 'T':
+		// switch to the previous tab
+		c.ClearMessage()
+		c.SwitchTab((c.Tab + len(c.Tabs) - 1) % len(c.Tabs))
 	case '\t':
 		// Toggle bookmark browser focus on/off
 		c.BookMarks.ToggleFocused()
@@ -277,6 +333,10 @@ func (c *client) TakeControlInput() {
 		} else if strings.TrimSpace(entry) == "" {
 			c.DrawMessage()
 			break
+		} else if engine, query, ok := c.Engines.Match(entry); ok {
+			// A line starting with an engine keyword is a search
+			c.search(query, engine.Url, "Search "+engine.Name)
+			break
 		}
 
 		parser := cmdparse.NewParser(strings.NewReader(entry))
@@ -294,6 +354,120 @@ func (c *client) TakeControlInput() {
 	}
 }
 
+// bookmarkInput handles the keys that act on the bookmarks
+// bar while it is focused. It reports whether input was used.
+func (c *client) bookmarkInput(input rune) bool {
+	switch input {
+	case '/':
+		// Fuzzy filter the bookmarks
+		c.ClearMessage()
+		c.filterBookmarks()
+	case '\n', '\r':
+		// Visit the selected bookmark
+		c.ClearMessage()
+		c.visitSelectedBookmark()
+	case 'J', 'K':
+		// Move the selected bookmark down or up
+		c.ClearMessage()
+		dir := 1
+		if input == 'K' {
+			dir = -1
+		}
+		c.shiftSelectedBookmark(dir)
+	case 27:
+		// Clear the fuzzy filter
+		if c.BookMarks.Query == "" {
+			return false
+		}
+		c.ClearMessage()
+		c.BookMarks.SetQuery("")
+		c.Draw()
+	default:
+		return false
+	}
+	return true
+}
+
+// filterBookmarks reads a query a key at a time, narrowing
+// the bookmarks bar to the fuzzy matches as it is typed.
+// Enter visits the selected match and Esc clears the query.
+// Ctrl-n and ctrl-p move the selection.
+func (c *client) filterBookmarks() {
+	query := []rune(c.BookMarks.Query)
+	for {
+		c.SetMessage("Filter bookmarks: enter to visit, esc to clear, ctrl-n/ctrl-p to select", false)
+		c.Draw()
+		switch ch := cui.Getch(); ch {
+		case 27:
+			c.BookMarks.SetQuery("")
+			c.ClearMessage()
+			c.Draw()
+			return
+		case '\n', '\r':
+			c.ClearMessage()
+			c.visitSelectedBookmark()
+			return
+		case 14:
+			c.BookMarks.Select(c.BookMarks.Selected+1, c.Height-5)
+		case 16:
+			c.BookMarks.Select(c.BookMarks.Selected-1, c.Height-5)
+		case 127, '\b':
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				c.BookMarks.SetQuery(string(query))
+			}
+		default:
+			if unicode.IsPrint(ch) {
+				query = append(query, ch)
+				c.BookMarks.SetQuery(string(query))
+			}
+		}
+	}
+}
+
+// visitSelectedBookmark visits the selected bookmark, or
+// opens or closes the selected folder
+func (c *client) visitSelectedBookmark() {
+	row, ok := c.BookMarks.SelectedRow()
+	if !ok {
+		c.SetMessage("There are no bookmarks to visit", true)
+		c.DrawMessage()
+		return
+	}
+	if row.Index < 0 {
+		_, _ = c.BookMarks.ToggleFolder(row.Folder)
+		c.Draw()
+		return
+	}
+	c.Visit(c.BookMarks.Links[row.Index])
+}
+
+// shiftSelectedBookmark moves the selected bookmark up or
+// down within its folder and saves the new order
+func (c *client) shiftSelectedBookmark(dir int) {
+	row, ok := c.BookMarks.SelectedRow()
+	if !ok || row.Index < 0 {
+		c.SetMessage("Select a bookmark to move it", true)
+		c.DrawMessage()
+		return
+	} else if c.BookMarks.Query != "" {
+		c.SetMessage("Bookmarks cannot be moved while they are filtered", true)
+		c.DrawMessage()
+		return
+	}
+	i, err := c.BookMarks.Shift(row.Index, dir)
+	if err == nil {
+		err = saveConfig()
+	}
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.BookMarks.SelectBookmark(i, c.Height-5)
+	c.Draw()
+}
+
 func (c *client) routeCommandInput(com *cmdparse.Command) error {
 	switch com.Type {
 	case cmdparse.SIMPLE:
@@ -322,10 +496,10 @@ func (c *client) simpleCommand(action string) {
 	action = strings.ToUpper(action)
 	switch action {
 	case "Q", "QUIT":
-		cui.Exit(0, "")
+		c.Quit(0)
 	case "H", "HOME":
 		if c.Options["homeurl"] != "unset" {
-			go c.Visit(c.Options["homeurl"])
+			c.Visit(c.Options["homeurl"])
 		} else {
 			c.SetMessage(fmt.Sprintf("No home address has been set"), false)
 			c.DrawMessage()
@@ -354,6 +528,26 @@ func (c *client) simpleCommand(action string) {
 		} else {
 			c.Draw()
 		}
+	case "IDENTITY", "ID":
+		c.identityCommand(nil)
+	case "HISTORY":
+		c.Visit("about:history")
+	case "CERTS":
+		c.Visit("about:certs")
+	case "INFO":
+		c.pageInfo()
+	case "CACHE":
+		c.cacheCommand(nil)
+	case "SESSION":
+		c.sessionCommand(nil)
+	case "SEARCHES":
+		c.Visit("about:searches")
+	case "ENGINES":
+		c.Visit("about:engines")
+	case "UPLOAD":
+		c.uploadCommand(nil)
+	case "TAB":
+		c.listTabs()
 	case "VERSION":
 		ver := version
 		if ver == "" {
@@ -399,8 +593,52 @@ func (c *client) doCommand(action string, values []string) {
 			c.SetMessage("Error saving purge to file", true)
 			c.DrawMessage()
 		}
+	case "IDENTITY", "ID":
+		c.identityCommand(values)
+	case "SESSION":
+		c.sessionCommand(values)
+	case "SEARCHES":
+		c.searchesCommand(values)
+	case "ENGINES":
+		c.enginesCommand(values)
+	case "UPLOAD":
+		c.uploadCommand(values)
+	case "CACHE":
+		c.cacheCommand(values)
+	case "BOOKMARKS", "B":
+		c.bookmarkCommand(values)
+	case "HISTORY":
+		if strings.ToLower(values[0]) != "clear" {
+			c.SetMessage(syntaxErrorMessage(action), true)
+			c.DrawMessage()
+			return
+		}
+		err := c.History.Clear()
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		c.SetMessage("History has been cleared", false)
+		c.DrawMessage()
+	case "TAB":
+		switch strings.ToLower(values[0]) {
+		case "new":
+			url := c.Options["homeurl"]
+			if url == "unset" {
+				url = ""
+			}
+			c.NewTab(url)
+		case "close":
+			c.CloseTab(c.Tab)
+		case "list":
+			c.listTabs()
+		default:
+			c.SetMessage(syntaxErrorMessage(action), true)
+			c.DrawMessage()
+		}
 	case "SEARCH":
-		c.search(values[0], "", "")
+		c.searchCommand(values)
 	case "WRITE", "W":
 		if values[0] == "." {
 			values[0] = c.PageState.History[c.PageState.Position].Location.Full
@@ -411,7 +649,8 @@ func (c *client) doCommand(action string, values []string) {
 			c.DrawMessage()
 			return
 		}
-		fns := strings.Split(u.Resource, "/")
+		// Gopher search terms and views follow a tab
+		fns := strings.Split(strings.SplitN(u.Resource, "\t", 2)[0], "/")
 		var fn string
 		if len(fns) > 0 {
 			fn = strings.Trim(fns[len(fns)-1], "\t\r\n \a\f\v")
@@ -456,13 +695,54 @@ func (c *client) doCommandAs(action string, values []string) {
 		if c.BookMarks.IsOpen {
 			c.Draw()
 		}
+	case "IDENTITY", "ID":
+		c.identityCommand(values)
+	case "SESSION":
+		c.sessionCommand(values)
+	case "SEARCHES":
+		c.searchesCommand(values)
+	case "ENGINES":
+		c.enginesCommand(values)
+	case "UPLOAD":
+		c.uploadCommand(values)
+	case "BOOKMARKS", "B":
+		c.bookmarkCommand(values)
+	case "TAB":
+		switch strings.ToLower(values[0]) {
+		case "new":
+			target := values[1]
+			if num, err := strconv.Atoi(target); err == nil {
+				links := c.PageState.History[c.PageState.Position].Links
+				if num < 1 || num > len(links) {
+					c.SetMessage(fmt.Sprintf("Invalid link id: %s", target), true)
+					c.DrawMessage()
+					return
+				}
+				target = links[num-1]
+				if c.blockedLink(target) {
+					return
+				}
+			}
+			c.NewTab(target)
+		case "close":
+			num, err := strconv.Atoi(values[1])
+			if err != nil {
+				c.SetMessage(fmt.Sprintf("Expected tab number, got %q", values[1]), true)
+				c.DrawMessage()
+				return
+			}
+			c.CloseTab(num - 1)
+		default:
+			c.SetMessage(syntaxErrorMessage(action), true)
+			c.DrawMessage()
+		}
 	case "SEARCH":
 		if len(values) < 2 {
 			c.SetMessage(syntaxErrorMessage(action), true)
 			c.DrawMessage()
 			return
 		}
-		c.search(strings.Join(values, " "), "", "")
+		c.searchCommand(values)
 	case "SET", "S":
 		if len(values) < 2 {
 			c.SetMessage(syntaxErrorMessage(action), true)
@@ -476,11 +756,25 @@ func (c *client) doCommandAs(action string, values []string) {
 				c.DrawMessage()
 				return
 			}
+			if values[0] == "cabundle" {
+				err := updateCABundle(val)
+				if err != nil {
+					c.SetMessage(fmt.Sprintf("Unable to load CA bundle: %s", err.Error()), true)
+					c.DrawMessage()
+					return
+				}
+			}
 			c.Options[values[0]] = lowerCaseOpt(values[0], val)
 			if values[0] == "geminiblocks" {
 				gemini.BlockBehavior = c.Options[values[0]]
+			} else if values[0] == "geminitls" {
+				gemini.TlsMode = c.Options[values[0]]
+			} else if values[0] == "gophertls" {
+				gopher.OpportunisticTLS = c.Options[values[0]] == "opportunistic"
 			} else if values[0] == "timeout" {
 				updateTimeouts(c.Options[values[0]])
+			} else if values[0] == "cachettl" || values[0] == "cachesize" {
+				_ = c.updateCache()
 			} else if values[0] == "configlocation" {
 				c.SetMessage("Cannot set READ ONLY setting 'configlocation'", true)
 				c.DrawMessage()
@@ -555,35 +849,73 @@ func (c *client) doLinkCommandAs(action, target string, values []string) {
 }
 
 func (c *client) saveFile(u Url, name string) {
-	var file []byte
-	var err error
-	c.SetMessage(fmt.Sprintf("Saving %s ...", name), false)
-	c.DrawMessage()
+	if c.Options["offline"] == "true" {
+		c.SetMessage("Files cannot be downloaded while offline", true)
+		c.DrawMessage()
+		return
+	}
+	var download func(io.Writer) error
 	switch u.Scheme {
-	case "gopher":
-		file, err = gopher.Retrieve(u.Host, u.Port, u.Resource)
+	case "gopher", "gophers":
+		download = func(w io.Writer) error {
+			return c.load(func(ctx context.Context) error {
+				return gopher.Download(ctx, u.Host, u.Port, u.Resource, u.Scheme == "gophers", &c.Certs, w)
+			})
+		}
 	case "gemini":
-		file, err = gemini.Fetch(u.Host, u.Port, u.Resource, &c.Certs)
+		download = func(w io.Writer) error {
+			return c.load(func(ctx context.Context) error {
+				return gemini.Download(ctx, u.Host, u.Port, u.Resource, &c.Certs, &c.Identities, w)
+			})
+		}
+	case "nex":
+		download = func(w io.Writer) error {
+			return c.load(func(ctx context.Context) error {
+				return nex.Download(ctx, u.Host, u.Port, u.Resource, w)
+			})
+		}
+	case "spartan":
+		resource, data := spartan.SplitQuery(u.Resource)
+		download = func(w io.Writer) error {
+			return c.load(func(ctx context.Context) error {
+				return spartan.Download(ctx, u.Host, u.Port, resource, data, w)
+			})
+		}
 	case "http", "https":
-		file, err = http.Fetch(u.Full)
+		download = func(w io.Writer) error {
+			return c.load(func(ctx context.Context) error {
+				return http.Download(ctx, u.Full, w)
+			})
+		}
 	default:
 		c.SetMessage(fmt.Sprintf("Saving files over %s is not supported", u.Scheme), true)
 		c.DrawMessage()
 		return
 	}
 
+	c.SetMessage(fmt.Sprintf("Saving %s ...", name), false)
+	c.DrawMessage()
+
+	// We are ignoring the error here since OpenFile will
+	// generate the same error, and will handle the messaging
+	savePath, _ := findAvailableFileName(c.Options["savelocation"], name)
+	file, err := os.OpenFile(savePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
-		c.SetMessage(err.Error(), true)
+		c.SetMessage("Error writing file: "+err.Error(), true)
 		c.DrawMessage()
 		return
 	}
 
-	// We are ignoring the error here since WriteFile will
-	// generate the same error, and will handle the messaging
-	savePath, _ := findAvailableFileName(c.Options["savelocation"], name)
-	err = ioutil.WriteFile(savePath, file, 0644)
+	// The response is streamed straight to disk, a failed
+	// download should not leave a partial file behind
+	err = download(file)
+	closeErr := file.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("Error writing file: %s", closeErr.Error())
+	}
 	if err != nil {
-		c.SetMessage("Error writing file: "+err.Error(), true)
+		_ = os.Remove(savePath)
+		c.SetMessage(err.Error(), true)
 		c.DrawMessage()
 		return
 	}
@@ -592,6 +924,72 @@ func (c *client) saveFile(u Url, name string) {
 	c.DrawMessage()
 }
 
+// load runs fn, which should stop when its context is cancelled,
+// while watching for the user to press Esc. Pressing Esc (or
+// Ctrl-C, via CancelLoad) abandons the load and leaves the
+// current page untouched. Responses read with its context show
+// their progress in the message bar.
+func (c *client) load(fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = stream.WithProgress(ctx, c.ShowProgress)
+	ctx = stream.WithMaxSize(ctx, c.maxBodySize())
+	c.loadLock.Lock()
+	c.cancelLoad = cancel
+	c.loadLock.Unlock()
+	defer func() {
+		c.loadLock.Lock()
+		c.cancelLoad = nil
+		c.loadLock.Unlock()
+		cancel()
+	}()
+
+	var err error
+	done := make(chan struct{})
+	go func() {
+		err = fn(ctx)
+		close(done)
+	}()
+	if cui.WaitForKey(done, 27) {
+		cancel()
+	}
+	<-done
+
+	if ctx.Err() != nil {
+		return errLoadCancelled
+	}
+	return err
+}
+
+// CancelLoad cancels the page load in progress, if any, and
+// reports whether there was one to cancel
+func (c *client) CancelLoad() bool {
+	c.loadLock.Lock()
+	defer c.loadLock.Unlock()
+	if c.cancelLoad == nil {
+		return false
+	}
+	c.cancelLoad()
+	return true
+}
+
+// post hands task to the main loop, to run between key presses.
+// Other goroutines use it for anything that touches the tabs or
+// the screen.
+func (c *client) post(task func()) {
+	c.tasks <- task
+}
+
+func (c *client) taskPending() bool {
+	return len(c.tasks) > 0
+}
+
+// ShowProgress displays the amount of data received so far,
+// and the rate it is arriving at, in the message bar
+func (c *client) ShowProgress(received int64, rate float64) {
+	c.SetMessage(fmt.Sprintf("Receiving... %s (%s/s)", stream.FormatSize(received), stream.FormatSize(int64(rate))), false)
+	c.DrawMessage()
+}
+
 func (c *client) saveFileFromData(d, name string) {
 	data := []byte(d)
 	c.SetMessage(fmt.Sprintf("Saving %s ...", name), false)
@@ -656,6 +1054,10 @@ func (c *client) doLinkCommand(action, target string) {
 		link := links[num]
 		c.SetMessage(fmt.Sprintf("[%d] %s", num+1, link), false)
 		c.DrawMessage()
+	case "INFO":
+		c.linkInfo(num)
+	case "TAB":
+		c.SwitchTab(num - 1)
 	case "JUMP", "J":
 		num--
 		err = c.PageState.CopyHistory(num)
@@ -678,7 +1080,8 @@ func (c *client) doLinkCommand(action, target string) {
 			c.DrawMessage()
 			return
 		}
-		fns := strings.Split(u.Resource, "/")
+		// Gopher search terms and views follow a tab
+		fns := strings.Split(strings.SplitN(u.Resource, "\t", 2)[0], "/")
 		var fn string
 		if len(fns) > 0 {
 			fn = strings.Trim(fns[len(fns)-1], "\t\r\n \a\f\v")
@@ -696,17 +1099,40 @@ func (c *client) doLinkCommand(action, target string) {
 
 }
 
+// search visits the results of a query at the search endpoint
+// uri, or the default engine set by the 'searchengine' setting
+// if uri is empty. The setting may be a url or the keyword of
+// an engine. Without a query the user is prompted with
+// question, and can recall earlier queries made at the same
+// endpoint with the arrow keys. Queries are added to that
+// history unless no question is given, as for sensitive input.
 func (c *client) search(query, uri, question string) {
+	if uri == "" {
+		uri = c.Options["searchengine"]
+		if engine, ok := c.Engines.Find(uri); ok {
+			uri = engine.Url
+		}
+	}
+	u, err := MakeUrl(uri)
+	if err != nil {
+		c.SetMessage("The search url is not valid", true)
+		c.DrawMessage()
+		return
+	}
+	endpoint, _, _ := splitSearchUrl(u)
+	if u.Scheme == "http" || u.Scheme == "https" {
+		// Http engines are templates and are kept whole
+		endpoint = uri
+	}
+
 	var entry string
-	var err error
 	if query == "" {
 		c.ClearMessage()
 		c.ClearMessageLine()
 		if c.Options["theme"] == "normal" || c.Options["theme"] == "color" {
 			fmt.Printf("\033[7m%*.*s\r", c.Width, c.Width, "")
 		}
-		fmt.Print(question)
-		entry, err = cui.GetLine("? ")
+		entry, err = cui.GetLineWithHistory(question+"? ", c.Searches.History(endpoint))
 		c.ClearMessageLine()
 		if err != nil {
 			c.SetMessage(err.Error(), true)
@@ -720,63 +1146,48 @@ func (c *client) search(query, uri, question string) {
 	} else {
 		entry = query
 	}
-	if uri == "" {
-		uri = c.Options["searchengine"]
-	}
-	u, err := MakeUrl(uri)
-	if err != nil {
-		c.SetMessage("The search url is not valid", true)
-		c.DrawMessage()
-		return
+	if question != "" {
+		_ = c.Searches.Record(endpoint, entry)
 	}
-	var rootUrl string
+
 	switch u.Scheme {
-	case "gopher":
-		if ind := strings.Index(u.Full, "\t"); ind >= 0 {
-			rootUrl = u.Full[:ind]
-		} else {
-			rootUrl = u.Full
-		}
-		c.Visit(fmt.Sprintf("%s\t%s", rootUrl, entry))
-	case "gemini":
-		if ind := strings.Index(u.Full, "?"); ind >= 0 {
-			rootUrl = u.Full[:ind]
-		} else {
-			rootUrl = u.Full
-		}
-		escapedEntry := url.PathEscape(entry)
-		c.Visit(fmt.Sprintf("%s?%s", rootUrl, escapedEntry))
-	case "http", "https":
-		c.Visit(u.Full)
+	case "gopher", "gophers", "gemini", "spartan", "cso", "http", "https":
+		c.Visit(searchUrl(u.Scheme, endpoint, entry))
 	default:
 		c.SetMessage(fmt.Sprintf("%q is not a supported protocol", u.Scheme), true)
 		c.DrawMessage()
 	}
 }
 
+// searchCommand runs the search command. A first word that is
+// the keyword of an engine picks that engine, otherwise the
+// words are sent to the default engine.
+func (c *client) searchCommand(values []string) {
+	entry := strings.Join(values, " ")
+	if engine, query, ok := c.Engines.Match(entry); ok {
+		c.search(query, engine.Url, "Search "+engine.Name)
+		return
+	}
+	c.search(entry, "", "?")
+}
+
 func (c *client) Scroll(amount int) {
 	if c.BookMarks.IsFocused {
-		bottom := len(c.BookMarks.Titles) - c.Height + 5 // 3 for the three bars: top, msg, bottom
-		if amount < 0 && c.BookMarks.Position == 0 {
+		// Scrolling the bookmarks bar moves its selection
+		rows := len(c.BookMarks.List())
+		if amount < 0 && c.BookMarks.Selected <= 0 {
 			c.SetMessage("The bookmark ladder does not go up any further", false)
 			c.DrawMessage()
 			fmt.Print("\a")
 			return
-		} else if (amount > 0 && c.BookMarks.Position == bottom) || bottom < 0 {
+		} else if amount > 0 && c.BookMarks.Selected >= rows-1 {
 			c.SetMessage("Feel the ground beneath your bookmarks", false)
 			c.DrawMessage()
 			fmt.Print("\a")
 			return
 		}
 
-		newScrollPosition := c.BookMarks.Position + amount
-		if newScrollPosition < 0 {
-			newScrollPosition = 0
-		} else if newScrollPosition > bottom {
-			newScrollPosition = bottom
-		}
-
-		c.BookMarks.Position = newScrollPosition
+		c.BookMarks.Select(c.BookMarks.Selected+amount, c.Height-5)
 	} else {
 		var percentRead int
 		page := c.PageState.History[c.PageState.Position]
@@ -826,12 +1237,87 @@ func (c *client) ReloadPage() error {
 			return err
 		}
 	}
+	pos := c.PageState.Position + 1
 	length := c.PageState.Length
+	// A reload always goes to the network, unless offline
+	c.refresh = true
 	c.Visit(url)
+	c.refresh = false
+	if c.PageState.Position < pos {
+		// The reload failed or was cancelled, stay put
+		c.PageState.Position = pos
+	}
 	c.PageState.Length = length
 	return nil
 }
 
+// NewTab opens a new tab, with its own history, and makes
+// it the active tab. If url is not empty it is visited in
+// the new tab.
+func (c *client) NewTab(url string) {
+	pages := MakePages()
+	c.Tabs = append(c.Tabs, &pages)
+	c.SwitchTab(len(c.Tabs) - 1)
+	if url != "" {
+		c.Visit(url)
+	}
+}
+
+// SwitchTab makes the tab at index i the active tab
+func (c *client) SwitchTab(i int) {
+	if i < 0 || i >= len(c.Tabs) {
+		c.SetMessage(fmt.Sprintf("There is no tab %d", i+1), true)
+		c.DrawMessage()
+		return
+	}
+	c.Tab = i
+	c.PageState = c.Tabs[i]
+	c.SetHeaderUrl()
+	if c.PageState.Length > 0 {
+		c.SetPercentRead()
+	}
+	c.Draw()
+}
+
+// CloseTab closes the tab at index i, along with its history.
+// The last remaining tab cannot be closed.
+func (c *client) CloseTab(i int) {
+	if i < 0 || i >= len(c.Tabs) {
+		c.SetMessage(fmt.Sprintf("There is no tab %d", i+1), true)
+		c.DrawMessage()
+		return
+	} else if len(c.Tabs) == 1 {
+		c.SetMessage("The only open tab cannot be closed", true)
+		c.DrawMessage()
+		return
+	}
+	c.Tabs = append(c.Tabs[:i], c.Tabs[i+1:]...)
+	if c.Tab > i || c.Tab == len(c.Tabs) {
+		c.Tab--
+	}
+	c.SetMessage(fmt.Sprintf("Closed tab %d", i+1), false)
+	c.SwitchTab(c.Tab)
+}
+
+// listTabs displays the open tabs, and the url each is
+// showing, in the message bar
+func (c *client) listTabs() {
+	tabs := make([]string, 0, len(c.Tabs))
+	for i, t := range c.Tabs {
+		url := "(empty)"
+		if t.Length > 0 {
+			url = t.History[t.Position].Location.Full
+		}
+		marker := ""
+		if i == c.Tab {
+			marker = "*"
+		}
+		tabs = append(tabs, fmt.Sprintf("%s[%d] %s", marker, i+1, url))
+	}
+	c.SetMessage(strings.Join(tabs, "  "), false)
+	c.DrawMessage()
+}
+
 func (c *client) SetPercentRead() {
 	page := c.PageState.History[c.PageState.Position]
 	var percentRead int
@@ -891,6 +1377,28 @@ func (c *client) ClearMessageLine() {
 	cui.Clear("line")
 }
 
+// getLine prompts the user for a line of input on the message
+// line and returns the trimmed result
+func (c *client) getLine(prompt string) (string, error) {
+	return c.prompt(prompt, cui.GetLine)
+}
+
+// getSecret works as getLine does, but does not echo the input
+func (c *client) getSecret(prompt string) (string, error) {
+	return c.prompt(prompt, cui.GetSecret)
+}
+
+func (c *client) prompt(prompt string, read func(string) (string, error)) (string, error) {
+	c.ClearMessage()
+	c.ClearMessageLine()
+	if c.Options["theme"] == "normal" || c.Options["theme"] == "color" {
+		fmt.Printf("\033[7m%*.*s\r", c.Width, c.Width, "")
+	}
+	entry, err := read(prompt)
+	c.ClearMessageLine()
+	return strings.TrimSpace(entry), err
+}
+
 func (c *client) goToURL(u string) {
 	if num, _ := regexp.MatchString(`^-?\d+.?\d*$`, u); num {
 		c.goToLink(u)
@@ -911,6 +1419,9 @@ func (c *client) goToLink(l string) {
 		}
 		if item <= linkcount && item > 0 {
 			linkurl := c.PageState.History[c.PageState.Position].Links[item-1]
+			if c.blockedLink(linkurl) {
+				return
+			}
 			c.Visit(linkurl)
 		} else {
 			c.SetMessage(fmt.Sprintf("Invalid link id: %s", l), true)
@@ -920,18 +1431,54 @@ func (c *client) goToLink(l string) {
 	}
 }
 
+// blockedLink reports whether link is an about: action that
+// was found on a page that is not an about: page, showing an
+// error if it is. Pages from elsewhere cannot be trusted to
+// link to them.
+func (c *client) blockedLink(link string) bool {
+	if !aboutAction(link) {
+		return false
+	}
+	if c.PageState.Length > 0 && c.PageState.History[c.PageState.Position].Location.Scheme == "about" {
+		return false
+	}
+	c.SetMessage(fmt.Sprintf("%s can only be followed from an about: page", link), true)
+	c.DrawMessage()
+	return true
+}
+
+// SetHeaderUrl shows the url of the current page in the top
+// bar, marking pages that arrived over TLS and gopher pages
+// that did not
 func (c *client) SetHeaderUrl() {
+	c.TopBar.security = ""
 	if c.PageState.Length > 0 {
-		u := c.PageState.History[c.PageState.Position].Location.Full
-		c.TopBar.url = strings.Replace(u, "\t", "%09", -1)
+		pg := c.PageState.History[c.PageState.Position]
+		c.TopBar.url = strings.Replace(pg.Location.Full, "\t", "%09", -1)
+		if pg.Encrypted {
+			c.TopBar.security = "[TLS]"
+		} else if pg.Location.Scheme == "gopher" {
+			c.TopBar.security = "[PLAIN]"
+		}
 	} else {
 		c.TopBar.url = ""
 	}
 }
 
-// Visit functions as a controller/router to the
-// appropriate protocol handler
+// Visit starts a new navigation to url, informing the user
+// of any redirects that were followed along the way
 func (c *client) Visit(url string) {
+	c.redirects = c.redirects[:0]
+	c.route(url)
+	if len(c.redirects) > 1 && c.Message == "" {
+		c.SetMessage("Redirected: "+strings.Join(c.redirects, " -> "), false)
+		c.DrawMessage()
+	}
+}
+
+// route functions as a controller/router to the
+// appropriate protocol handler
+func (c *client) route(url string) {
 	c.SetMessage("Loading...", false)
 	c.DrawMessage()
 
@@ -943,11 +1490,23 @@ func (c *client) Visit(url string) {
 		return
 	}
 
+	if c.Options["offline"] == "true" && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "telnet") {
+		c.SetMessage(fmt.Sprintf("%s cannot be visited while offline", u.Full), true)
+		c.DrawMessage()
+		return
+	}
+
 	switch u.Scheme {
-	case "gopher":
+	case "gopher", "gophers":
 		c.handleGopher(u)
 	case "gemini":
 		c.handleGemini(u)
+	case "spartan":
+		c.handleSpartan(u)
+	case "nex":
+		c.handleNex(u)
+	case "cso":
+		c.handleCso(u)
 	case "telnet":
 		c.handleTelnet(u)
 	case "http", "https":
@@ -956,103 +1515,1319 @@ func (c *client) Visit(url string) {
 		c.handleLocal(u)
 	case "finger":
 		c.handleFinger(u)
+	case "about":
+		c.handleAbout(u)
+	case "titan":
+		c.SetMessage("Titan urls cannot be visited, use the 'upload' command from the gemini page instead", true)
+		c.DrawMessage()
 	default:
 		c.SetMessage(fmt.Sprintf("%q is not a supported protocol", u.Scheme), true)
 		c.DrawMessage()
 	}
 }
 
-// +++ Begin Protocol Handlers +++
-
-func (c *client) handleGopher(u Url) {
-	if u.DownloadOnly || (c.Options["showimages"] == "false" && (u.Mime == "I" || u.Mime == "g")) {
-		nameSplit := strings.Split(u.Resource, "/")
-		filename := nameSplit[len(nameSplit)-1]
-		filename = strings.Trim(filename, " \t\r\n\v\f\a")
-		if filename == "" {
-			filename = "gopherfile"
+// retrieve returns the response for u from the cache if it
+// is there, otherwise it is requested with fetch and cached.
+// If cacheable is not nil it decides which responses are
+// stored. While offline only the cache is used.
+func (c *client) retrieve(u Url, fetch func(ctx context.Context) ([]byte, error), cacheable func([]byte) bool) ([]byte, error) {
+	offline := c.Options["offline"] == "true"
+	if !c.refresh || offline {
+		if resp, _, ok := c.Cache.Get(u.Full, offline); ok {
+			return resp, nil
 		}
-		c.saveFile(u, filename)
-	} else if u.Mime == "7" {
-		c.search("", u.Full, "?")
-	} else {
-		content, links, err := gopher.Visit(u.Mime, u.Host, u.Port, u.Resource)
+	}
+	if offline {
+		return nil, fmt.Errorf("%s is not in the cache and cannot be visited while offline", u.Full)
+	}
+
+	var resp []byte
+	err := c.load(func(ctx context.Context) error {
+		var err error
+		resp, err = fetch(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cacheable == nil || cacheable(resp) {
+		_ = c.Cache.Put(u.Full, resp)
+	}
+	return resp, nil
+}
+
+// cacheCommand displays statistics about the cache, or purges it
+func (c *client) cacheCommand(values []string) {
+	if len(values) == 0 || strings.ToLower(values[0]) == "stats" {
+		s, err := c.Cache.Stats()
 		if err != nil {
 			c.SetMessage(err.Error(), true)
 			c.DrawMessage()
 			return
 		}
-		pg := MakePage(u, content, links)
-		if u.Mime == "I" || u.Mime == "g" {
-			pg.FileType = "image"
-		} else {
-			pg.FileType = "text"
+		mode := "online"
+		if c.Options["offline"] == "true" {
+			mode = "offline"
 		}
-		pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
-		c.PageState.Add(pg)
-		c.SetPercentRead()
-		c.ClearMessage()
-		c.SetHeaderUrl()
-		c.Draw()
+		c.SetMessage(fmt.Sprintf("Cache (%s): %d pages, %s of %s MB, %d hits, %d misses", mode, s.Entries, stream.FormatSize(s.Size), c.Options["cachesize"], s.Hits, s.Misses), false)
+		c.DrawMessage()
+		return
+	} else if len(values) != 1 || strings.ToLower(values[0]) != "purge" {
+		c.SetMessage(syntaxErrorMessage("CACHE"), true)
+		c.DrawMessage()
+		return
+	}
+	err := c.Cache.Purge()
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.SetMessage("The cache has been purged", false)
+	c.DrawMessage()
+}
+
+// updateCache applies the cache settings to the cache
+func (c *client) updateCache() error {
+	ttl, err := strconv.Atoi(c.Options["cachettl"])
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(c.Options["cachesize"])
+	if err != nil {
+		return err
+	}
+	c.Cache.TTL = time.Duration(ttl) * time.Minute
+	c.Cache.MaxSize = int64(size) * 1024 * 1024
+	c.Cache.SetDir(filepath.Join(c.Options["configlocation"], ".bombadillo-cache"))
+	return nil
+}
+
+// maxBodySize returns the 'maxbodysize' setting in bytes, the
+// largest document that a load will read into memory
+func (c *client) maxBodySize() int64 {
+	mb, err := strconv.Atoi(c.Options["maxbodysize"])
+	if err != nil {
+		return 0
+	}
+	return int64(mb) * 1024 * 1024
+}
+
+// addPage adds pg to the page history of the client and
+// records the visit in the browsing history
+func (c *client) addPage(pg Page) {
+	c.PageState.Add(pg)
+	if pg.Location.Scheme != "about" {
+		_ = c.History.Add(pg.Location.Full, pg.Title())
+	}
+}
+
+// +++ Begin Protocol Handlers +++
+
+func (c *client) handleGopher(u Url) {
+	selector, _, view := gopher.SplitRequest(u.Resource)
+	if view == "!" {
+		c.gopherAttributes(u)
+	} else if u.DownloadOnly || (view != "" && !gopher.IsTextView(view)) || (c.Options["showimages"] == "false" && (u.Mime == "I" || u.Mime == "g")) {
+		nameSplit := strings.Split(selector, "/")
+		filename := nameSplit[len(nameSplit)-1]
+		filename = strings.Trim(filename, " \t\r\n\v\f\a")
+		if filename == "" {
+			filename = "gopherfile"
+		}
+		c.saveFile(u, filename)
+	} else if u.Mime == "7" {
+		c.search("", u.Full, "?")
+	} else if u.Mime == "2" {
+		c.handleCso(u)
+	} else {
+		secure := u.Scheme == "gophers"
+		cacheable := func(resp []byte) bool {
+			return !gopher.IsErrorMenu(u.Mime, resp)
+		}
+		resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+			return gopher.Retrieve(ctx, u.Host, u.Port, u.Resource, secure, &c.Certs)
+		}, cacheable)
+		if changed, ok := err.(*gemini.CertChangeError); ok {
+			c.certificateChanged(u, changed)
+			return
+		} else if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		content, links := gopher.Parse(u.Mime, resp, u.Host, u.Port, secure)
+		pg := MakePage(u, content, links)
+		if u.Mime == "I" || u.Mime == "g" {
+			pg.FileType = "image"
+		} else {
+			pg.FileType = "text"
+		}
+		pg.Encrypted = secure || gopher.Encrypted(u.Host, u.Port)
+		if pg.Encrypted {
+			pg.Security = strings.TrimSpace("Encrypted with TLS. " + c.Certs.Verification(net.JoinHostPort(u.Host, u.Port)))
+			go saveConfig()
+		} else {
+			pg.Security = "Not encrypted"
+		}
+		pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+		c.addPage(pg)
+		c.SetPercentRead()
+		c.ClearMessage()
+		c.SetHeaderUrl()
+		c.Draw()
+	}
+}
+
+func (c *client) handleGemini(u Url) {
+	// Only successful responses are cached, and never those
+	// requested with a client certificate
+	_, withIdentity := c.Identities.Find(u.Host, u.Resource)
+	cacheable := func(resp []byte) bool {
+		return !withIdentity && len(resp) > 0 && resp[0] == '2'
+	}
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		resp, err := gemini.Retrieve(ctx, u.Host, u.Port, u.Resource, &c.Certs, &c.Identities)
+		return []byte(resp), err
+	}, cacheable)
+	if changed, ok := err.(*gemini.CertChangeError); ok {
+		c.certificateChanged(u, changed)
+		return
+	} else if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	capsule, err := gemini.ParseCapsule(string(resp), u.Host, u.Port, u.Resource)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	go saveConfig()
+	c.handleCapsule(u, capsule)
+}
+
+// handleCapsule acts on a gemini response to a request for u,
+// which may also be the response to a titan upload
+func (c *client) handleCapsule(u Url, capsule gemini.Capsule) {
+	switch capsule.Status {
+	case 10:
+		// Query
+		c.search("", u.Full, capsule.Content)
+	case 11:
+		// Sensitive query, read without echo
+		entry, err := c.getSecret(capsule.Content + "? ")
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		} else if entry == "" {
+			c.DrawMessage()
+			return
+		}
+		c.search(entry, u.Full, "")
+	case 20:
+		// Success
+		if capsule.MimeMaj == "text" || (c.Options["showimages"] == "true" && capsule.MimeMaj == "image") {
+			u.Mime = capsule.MimeMin
+			pg := MakePage(u, capsule.Content, capsule.Links)
+			pg.FileType = capsule.MimeMaj
+			pg.Security = c.Certs.Verification(u.Host)
+			pg.Encrypted = true
+			pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+			c.addPage(pg)
+			c.SetPercentRead()
+			c.ClearMessage()
+			c.SetHeaderUrl()
+			c.Draw()
+		} else {
+			c.SetMessage("The file is non-text: writing to disk...", false)
+			c.DrawMessage()
+			nameSplit := strings.Split(u.Resource, "/")
+			filename := nameSplit[len(nameSplit)-1]
+			c.saveFileFromData(capsule.Content, filename)
+		}
+	case 30, 31:
+		// Redirect
+		if !strings.Contains(capsule.Content, "://") {
+			lnk, lnkErr := gemini.HandleRelativeUrl(capsule.Content, u.Full)
+			if lnkErr == nil {
+				capsule.Content = lnk
+			}
+		}
+		if capsule.Status == 31 {
+			c.offerBookmarkUpdate(u, capsule.Content)
+		}
+		c.followRedirect(u, capsule.Content)
+	case 44:
+		// Slow down
+		c.slowDown(u, capsule.Content)
+	case 60:
+		// Client certificate required
+		c.chooseIdentity(u, capsule.Content)
+	}
+}
+
+// gopherAttributes shows the Gopher+ attributes of the item
+// at u, which ends with an attribute request. Each of the
+// views it is offered in can be followed to download it.
+func (c *client) gopherAttributes(u Url) {
+	secure := u.Scheme == "gophers"
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		return gopher.Retrieve(ctx, u.Host, u.Port, u.Resource, secure, &c.Certs)
+	}, nil)
+	if changed, ok := err.(*gemini.CertChangeError); ok {
+		c.certificateChanged(u, changed)
+		return
+	} else if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	content, links, err := gopher.ParseAttributePage(u.Mime, u.Host, u.Port, u.Resource, resp, secure)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	pg := MakePage(u, content, links)
+	pg.FileType = "text"
+	pg.Encrypted = secure || gopher.Encrypted(u.Host, u.Port)
+	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+	c.addPage(pg)
+	c.SetPercentRead()
+	c.ClearMessage()
+	c.SetHeaderUrl()
+	c.Draw()
+}
+
+// linkInfo shows information about a link on the current
+// page. Gopher items have their Gopher+ attributes fetched,
+// for anything else the url is shown.
+func (c *client) linkInfo(num int) {
+	if c.PageState.Length < 1 {
+		c.SetMessage("There is no page to show link information from", true)
+		c.DrawMessage()
+		return
+	}
+	links := c.PageState.History[c.PageState.Position].Links
+	if num < 1 || num > len(links) {
+		c.SetMessage(fmt.Sprintf("Invalid link id: %d", num), true)
+		c.DrawMessage()
+		return
+	}
+	u, err := MakeUrl(links[num-1])
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	if u.Scheme != "gopher" && u.Scheme != "gophers" {
+		c.SetMessage(fmt.Sprintf("[%d] %s", num, u.Full), false)
+		c.DrawMessage()
+		return
+	}
+	selector, search, _ := gopher.SplitRequest(u.Resource)
+	c.Visit(fmt.Sprintf("%s://%s/%s%s\t%s\t!", u.Scheme, hostPort(u.Host, u.Port), u.Mime, selector, search))
+}
+
+// handleCso looks up the query in u on a CSO server, u is
+// either a cso url or a gopher type 2 item. Without a query
+// the user is asked for one, as they are for type 7 items.
+func (c *client) handleCso(u Url) {
+	var query string
+	if u.Scheme == "cso" {
+		if ind := strings.Index(u.Resource, "?"); ind >= 0 {
+			query, _ = url.PathUnescape(u.Resource[ind+1:])
+		}
+	} else {
+		_, query, _ = gopher.SplitRequest(u.Resource)
+	}
+	if strings.TrimSpace(query) == "" {
+		c.search("", u.Full, "?")
+		return
+	}
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		return cso.Query(ctx, u.Host, u.Port, query)
+	}, nil)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	content, err := cso.Parse(resp)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	pg := MakePage(u, content, []string{})
+	pg.FileType = "text"
+	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+	c.addPage(pg)
+	c.SetPercentRead()
+	c.ClearMessage()
+	c.SetHeaderUrl()
+	c.Draw()
+}
+
+// handleNex visits a nex url, files that are not text are
+// saved rather than shown
+func (c *client) handleNex(u Url) {
+	if u.DownloadOnly {
+		nameSplit := strings.Split(u.Resource, "/")
+		c.saveFile(u, nameSplit[len(nameSplit)-1])
+		return
+	}
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		return nex.Retrieve(ctx, u.Host, u.Port, u.Resource)
+	}, nil)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	content, links := nex.Parse(resp, u.Host, u.Port, u.Resource)
+	pg := MakePage(u, content, links)
+	pg.FileType = "text"
+	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+	c.addPage(pg)
+	c.SetPercentRead()
+	c.ClearMessage()
+	c.SetHeaderUrl()
+	c.Draw()
+}
+
+// handleSpartan visits a spartan url. Urls ending with an
+// empty query come from '=:' links, the user is asked for
+// input which is uploaded as the body of the request.
+func (c *client) handleSpartan(u Url) {
+	if strings.HasSuffix(u.Full, "?") {
+		c.search("", u.Full, "Input")
+		return
+	}
+	// Requests that upload data are never cached
+	resource, data := spartan.SplitQuery(u.Resource)
+	cacheable := func(resp []byte) bool {
+		return len(data) == 0 && len(resp) > 0 && resp[0] == '2'
+	}
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		return spartan.Retrieve(ctx, u.Host, u.Port, resource, data)
+	}, cacheable)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	doc, err := spartan.Parse(resp, u.Host, u.Port, resource)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	switch doc.Status {
+	case 2:
+		if doc.MimeMaj == "text" || (c.Options["showimages"] == "true" && doc.MimeMaj == "image") {
+			u.Mime = doc.MimeMin
+			pg := MakePage(u, doc.Content, doc.Links)
+			pg.FileType = doc.MimeMaj
+			pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+			c.addPage(pg)
+			c.SetPercentRead()
+			c.ClearMessage()
+			c.SetHeaderUrl()
+			c.Draw()
+		} else {
+			c.SetMessage("The file is non-text: writing to disk...", false)
+			c.DrawMessage()
+			nameSplit := strings.Split(resource, "/")
+			filename := nameSplit[len(nameSplit)-1]
+			c.saveFileFromData(doc.Content, filename)
+		}
+	case 3:
+		c.followRedirect(u, doc.Content)
+	}
+}
+
+// followRedirect follows a redirect from u to target, either
+// automatically or after asking the user, as permitted by the
+// 'followredirects' setting. The chain of redirects is tracked
+// per navigation so that loops and long chains can be stopped
+func (c *client) followRedirect(u Url, target string) {
+	if len(c.redirects) == 0 {
+		c.redirects = append(c.redirects, u.Full)
+	}
+	tu, err := MakeUrl(target)
+	if err != nil {
+		c.SetMessage(fmt.Sprintf("Invalid redirect to %q: %s", target, err.Error()), true)
+		c.DrawMessage()
+		return
+	}
+
+	max, err := strconv.Atoi(c.Options["maxredirects"])
+	if err != nil {
+		max, _ = strconv.Atoi(defaultOptions["maxredirects"])
+	}
+	if len(c.redirects) > max {
+		c.SetMessage(fmt.Sprintf("Too many redirects (max %d): %s -> %s", max, strings.Join(c.redirects, " -> "), tu.Full), true)
+		c.DrawMessage()
+		return
+	}
+	for _, prev := range c.redirects {
+		if prev == tu.Full {
+			c.SetMessage(fmt.Sprintf("Redirect loop detected: %s -> %s", strings.Join(c.redirects, " -> "), tu.Full), true)
+			c.DrawMessage()
+			return
+		}
+	}
+	if aboutAction(tu.Full) {
+		c.SetMessage(fmt.Sprintf("Refusing to redirect to %s", tu.Full), true)
+		c.DrawMessage()
+		return
+	}
+	c.redirects = append(c.redirects, tu.Full)
+
+	lowerRedirect := strings.ToLower(tu.Full)
+	lowerOriginal := strings.ToLower(u.Full)
+	if strings.Replace(lowerRedirect, lowerOriginal, "", 1) == "/" || redirectAllowed(c.Options["followredirects"], u, tu) {
+		c.route(tu.Full)
+		return
+	}
+
+	kind := "cross-scheme"
+	if u.Scheme == tu.Scheme && strings.EqualFold(u.Host, tu.Host) && u.Port == tu.Port {
+		kind = "same-host"
+	} else if u.Scheme == tu.Scheme {
+		kind = "cross-host"
+	}
+	c.SetMessage(fmt.Sprintf("Follow %s redirect (y/n): %s?", kind, strings.Join(c.redirects, " -> ")), false)
+	c.DrawMessage()
+	ch := cui.Getch()
+	if ch == 'y' || ch == 'Y' {
+		c.route(tu.Full)
+	} else {
+		c.SetMessage("Redirect aborted", false)
+		c.DrawMessage()
+	}
+}
+
+// certificateChanged shows the certificate that is trusted
+// for a host alongside the new one it has presented, and lets
+// the user accept the new certificate once or permanently,
+// requesting u again, or reject it
+func (c *client) certificateChanged(u Url, e *gemini.CertChangeError) {
+	describe := func(cert gemini.CertInfo) string {
+		subject, expires := cert.Subject, "unknown"
+		if subject == "" {
+			subject = "unknown subject"
+		}
+		if !cert.Expires.IsZero() {
+			expires = cert.Expires.Format("2006-01-02")
+		}
+		return fmt.Sprintf("       %s, expires %s", subject, expires)
+	}
+	fingerprints := []string{"  Old: " + e.Old.Fingerprint, "  New: " + e.New.Fingerprint}
+	if e.NewSHA1 != "" {
+		// The old fingerprint was pinned by an older version,
+		// show the new one in the same form so they compare
+		fingerprints = []string{"  Old: SHA-1 " + e.Old.Fingerprint, "  New: SHA-1 " + e.NewSHA1}
+	}
+	lines := []string{
+		fmt.Sprintf("The certificate for %s has changed", e.Host),
+		"",
+		fingerprints[0],
+		describe(e.Old),
+		fingerprints[1],
+		describe(e.New),
+	}
+	c.Draw()
+	c.drawPanel(lines)
+	c.SetMessage("Certificate changed: accept (o)nce, accept (p)ermanently, any other key to reject", true)
+	c.DrawMessage()
+
+	switch cui.Getch() {
+	case 'o', 'O':
+		c.Certs.AcceptOnce(e.Host, e.New)
+	case 'p', 'P':
+		c.Certs.Accept(e.Host, e.New)
+		err := saveConfig()
+		if err != nil {
+			c.SetMessage("Error saving certificate to file", true)
+			c.Draw()
+			return
+		}
+	default:
+		c.SetMessage(fmt.Sprintf("The new certificate for %s was rejected", e.Host), false)
+		c.Draw()
+		return
+	}
+	c.ClearMessage()
+	c.Visit(u.Full)
+}
+
+// drawPanel draws lines over the bottom of the content area,
+// directly above the message line. They stay until the next
+// full redraw.
+func (c *client) drawPanel(lines []string) {
+	top := c.Height - 1 - len(lines)
+	if top < 1 {
+		lines = lines[1-top:]
+		top = 1
+	}
+	for i, ln := range lines {
+		cui.MoveCursorTo(top+i, 0)
+		fmt.Printf("\033[0m\033[2K%.*s", c.Width, ln)
+	}
+}
+
+// offerBookmarkUpdate asks the user whether bookmarks pointing
+// at a permanently redirected url should point at its new home
+func (c *client) offerBookmarkUpdate(u Url, target string) {
+	for i, link := range c.BookMarks.Links {
+		bu, err := MakeUrl(link)
+		if err != nil || bu.Full != u.Full {
+			continue
+		}
+		c.SetMessage(fmt.Sprintf("Bookmark %q has moved permanently. Update it (y/n)?", c.BookMarks.Titles[i]), false)
+		c.DrawMessage()
+		ch := cui.Getch()
+		if ch != 'y' && ch != 'Y' {
+			continue
+		}
+		c.BookMarks.Links[i] = target
+		err = saveConfig()
+		if err != nil {
+			c.SetMessage("Error saving bookmark update to file", true)
+			c.DrawMessage()
+		}
+	}
+}
+
+// slowDown informs the user of the wait time requested by a
+// status 44 response and lets them retry once it has passed
+func (c *client) slowDown(u Url, meta string) {
+	wait, err := strconv.Atoi(meta)
+	if err != nil || wait < 0 {
+		wait = 0
+	}
+	c.SetMessage(fmt.Sprintf("[44] Slow down: the server asks you to wait %d seconds. Retry when ready (y/n)?", wait), false)
+	c.DrawMessage()
+	ch := cui.Getch()
+	if ch != 'y' && ch != 'Y' {
+		c.SetMessage("Request abandoned", false)
+		c.DrawMessage()
+		return
+	}
+	err = c.load(func(ctx context.Context) error {
+		for ; wait > 0; wait-- {
+			c.SetMessage(fmt.Sprintf("Retrying in %d seconds...", wait), false)
+			c.DrawMessage()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.Visit(u.Full)
+}
+
+// chooseIdentity prompts the user to create or pick a client
+// certificate for the scope of u, then requests u again
+func (c *client) chooseIdentity(u Url, meta string) {
+	msg := "Certificate required"
+	if meta != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, meta)
+	}
+	c.SetMessage(msg+": (n)ew identity, (e)xisting identity, any other key to cancel", false)
+	c.DrawMessage()
+
+	var name string
+	switch cui.Getch() {
+	case 'n', 'N':
+		entry, err := c.getLine("New identity name: ")
+		if err != nil || entry == "" {
+			c.SetMessage("Certificate request cancelled", false)
+			c.DrawMessage()
+			return
+		}
+		name = entry
+		days := 365
+		entry, err = c.getLine(fmt.Sprintf("Valid for how many days? [%d]: ", days))
+		if err == nil && entry != "" {
+			days, err = strconv.Atoi(entry)
+			if err != nil {
+				c.SetMessage(fmt.Sprintf("Expected a number of days, got %q", entry), true)
+				c.DrawMessage()
+				return
+			}
+		}
+		_, err = c.Identities.Create(name, days)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+	case 'e', 'E':
+		names := c.Identities.Names()
+		if len(names) == 0 {
+			c.SetMessage("There are no existing identities, create a new one instead", true)
+			c.DrawMessage()
+			return
+		}
+		entry, err := c.getLine(fmt.Sprintf("Identity (%s): ", strings.Join(names, ", ")))
+		if err != nil || entry == "" {
+			c.SetMessage("Certificate request cancelled", false)
+			c.DrawMessage()
+			return
+		}
+		name = entry
+	default:
+		c.SetMessage("Certificate request cancelled", false)
+		c.DrawMessage()
+		return
+	}
+
+	err := c.Identities.Assign(gemini.Scope(u.Host, u.Resource), name)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	err = saveConfig()
+	if err != nil {
+		c.SetMessage("Error saving identity to file", true)
+		c.DrawMessage()
+		return
+	}
+	c.Visit(u.Full)
+}
+
+// identityCommand lists, renames, exports, or deletes client
+// certificate identities based on the values given
+func (c *client) identityCommand(values []string) {
+	if len(values) == 0 || strings.ToLower(values[0]) == "list" {
+		names := c.Identities.Names()
+		if len(names) == 0 {
+			c.SetMessage("There are no identities", false)
+			c.DrawMessage()
+			return
+		}
+		list := make([]string, 0, len(names))
+		for _, name := range names {
+			id, _ := c.Identities.Get(name)
+			list = append(list, fmt.Sprintf("%s (expires %s)", name, id.Expires.Format("2006-01-02")))
+		}
+		c.SetMessage("Identities: "+strings.Join(list, ", "), false)
+		c.DrawMessage()
+		return
+	}
+
+	var msg string
+	var err error
+	switch sub := strings.ToLower(values[0]); {
+	case sub == "rename" && len(values) == 3:
+		err = c.Identities.Rename(values[1], values[2])
+		msg = fmt.Sprintf("Identity %q renamed to %q", values[1], values[2])
+	case sub == "delete" && len(values) == 2:
+		err = c.Identities.Delete(values[1])
+		msg = fmt.Sprintf("Identity %q deleted", values[1])
+	case sub == "export" && (len(values) == 2 || len(values) == 3):
+		var path string
+		if len(values) == 3 {
+			path = values[2]
+		} else {
+			path, _ = findAvailableFileName(c.Options["savelocation"], values[1]+".pem")
+		}
+		err = c.Identities.Export(values[1], path)
+		msg = fmt.Sprintf("Identity %q exported to: %s", values[1], path)
+	default:
+		c.SetMessage(syntaxErrorMessage("IDENTITY"), true)
+		c.DrawMessage()
+		return
+	}
+
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	err = saveConfig()
+	if err != nil {
+		c.SetMessage("Error saving identities to file", true)
+		c.DrawMessage()
+		return
+	}
+	c.SetMessage(msg, false)
+	c.DrawMessage()
+}
+
+// bookmarkCommand handles filing, renaming, tagging and noting
+// bookmarks, along with folding folders and filtering by tag
+// in the bookmarks bar
+func (c *client) bookmarkCommand(values []string) {
+	sub := strings.ToLower(values[0])
+	if sub == "check" && len(values) == 1 {
+		c.checkBookmarks()
+		return
+	} else if sub == "filter" {
+		c.SetMessage(c.BookMarks.SetFilter(strings.Join(values[1:], " ")), false)
+		c.Draw()
+		return
+	} else if (sub == "export" || sub == "import") && len(values) > 1 {
+		c.bookmarkTransfer(sub, strings.ToLower(values[1]), strings.Join(values[2:], " "))
+		return
+	} else if sub == "toggle" && len(values) > 1 {
+		msg, err := c.BookMarks.ToggleFolder(strings.Join(values[1:], " "))
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		c.SetMessage(msg, false)
+		c.Draw()
+		return
+	}
+
+	if len(values) < 2 {
+		c.SetMessage(syntaxErrorMessage("BOOKMARKS"), true)
+		c.DrawMessage()
+		return
+	}
+	num, err := strconv.Atoi(values[1])
+	if err != nil {
+		c.SetMessage(fmt.Sprintf("Expected bookmark id, got %q", values[1]), true)
+		c.DrawMessage()
+		return
+	}
+	rest := strings.Join(values[2:], " ")
+
+	var msg string
+	switch {
+	case sub == "info" && len(values) == 2:
+		msg, err = c.BookMarks.Info(num)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+		} else {
+			c.SetMessage(msg, false)
+		}
+		c.DrawMessage()
+		return
+	case sub == "move":
+		msg, err = c.BookMarks.Move(num, rest)
+	case sub == "rename" && len(values) > 2:
+		msg, err = c.BookMarks.Rename(num, rest)
+	case sub == "tag":
+		msg, err = c.BookMarks.Tag(num, values[2:])
+	case sub == "note":
+		msg, err = c.BookMarks.Note(num, rest)
+	default:
+		c.SetMessage(syntaxErrorMessage("BOOKMARKS"), true)
+		c.DrawMessage()
+		return
+	}
+
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.SetMessage(msg, false)
+	err = saveConfig()
+	if err != nil {
+		c.SetMessage("Error saving bookmarks to file", true)
+	}
+	if c.BookMarks.IsOpen {
+		c.Draw()
+	} else {
+		c.DrawMessage()
+	}
+}
+
+// uploadCommand uploads a file, or text written in $EDITOR,
+// to the titan url of the current gemini page, optionally
+// with a token: upload [[path|edit]] [[token]]
+func (c *client) uploadCommand(values []string) {
+	if c.Options["offline"] == "true" {
+		c.SetMessage("Uploads are not possible while offline, see the 'offline' setting", true)
+		c.DrawMessage()
+		return
+	}
+	if len(values) > 2 {
+		c.SetMessage(syntaxErrorMessage("UPLOAD"), true)
+		c.DrawMessage()
+		return
+	}
+	if c.PageState.Position < 0 || c.PageState.History[c.PageState.Position].Location.Scheme != "gemini" {
+		c.SetMessage("Uploads are sent to the titan url of the current gemini page, open a gemini page first", true)
+		c.DrawMessage()
+		return
+	}
+	u := c.PageState.History[c.PageState.Position].Location
+	target, token := "edit", ""
+	if len(values) > 0 {
+		target = values[0]
+	}
+	if len(values) > 1 {
+		token = values[1]
+	}
+
+	var body io.Reader
+	var size int64
+	mime := "text/gemini"
+	if strings.ToLower(target) == "edit" {
+		text, err := c.editUpload(u)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.Draw()
+			return
+		}
+		body, size = bytes.NewReader(text), int64(len(text))
+	} else {
+		if strings.HasPrefix(target, "~") {
+			target = homePath() + target[1:]
+		}
+		file, err := os.Open(target)
+		if err != nil {
+			c.SetMessage("Error reading file: "+err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			c.SetMessage("Error reading file: "+err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		body, size, mime = file, info.Size(), uploadMime(target)
+	}
+
+	c.SetMessage(fmt.Sprintf("Uploading %s to %s", stream.FormatSize(size), titan.RequestUrl(u.Host, u.Port, u.Resource, size, mime, "")), false)
+	c.Draw()
+	var resp string
+	err := c.load(func(ctx context.Context) error {
+		var err error
+		resp, err = titan.Upload(ctx, u.Host, u.Port, u.Resource, body, size, mime, token, &c.Certs, &c.Identities)
+		return err
+	})
+	if changed, ok := err.(*gemini.CertChangeError); ok {
+		c.certificateChanged(u, changed)
+		return
+	} else if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	// The page has changed, the cached copy is out of date
+	_ = c.Cache.Delete(u.Full)
+	capsule, err := gemini.ParseCapsule(resp, u.Host, u.Port, u.Resource)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	go saveConfig()
+	c.handleCapsule(u, capsule)
+}
+
+// editUpload opens the source of the gemini page at u in the
+// editor named by $EDITOR, and returns the edited text. An
+// error is returned if nothing was changed.
+func (c *client) editUpload(u Url) ([]byte, error) {
+	// The page is requested again, its source is not kept
+	// once it has been rendered
+	var source []byte
+	err := c.load(func(ctx context.Context) error {
+		resp, err := gemini.Retrieve(ctx, u.Host, u.Port, u.Resource, &c.Certs, &c.Identities)
+		if err != nil {
+			return err
+		}
+		split := strings.SplitN(resp, "\n", 2)
+		if !strings.HasPrefix(resp, "2") || len(split) < 2 {
+			return fmt.Errorf("Unable to retrieve the page to edit: %s", strings.TrimSpace(split[0]))
+		}
+		source = []byte(split[1])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile("", "bombadillo-*.gmi")
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	_, err = file.Write(source)
+	closeErr := file.Close()
+	if err != nil {
+		return nil, err
+	} else if closeErr != nil {
+		return nil, closeErr
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cui.CleanupTerm()
+	err = cmd.Run()
+	cui.InitTerm()
+	if err != nil {
+		return nil, fmt.Errorf("Editor error: %s", err.Error())
+	}
+
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(text, source) {
+		return nil, fmt.Errorf("Upload cancelled, nothing was changed")
+	}
+	return text, nil
+}
+
+// bookmarkTransfer exports the bookmarks to, or imports them
+// from, the file at path in the given format
+func (c *client) bookmarkTransfer(direction, format, path string) {
+	ext, ok := BookmarkFormats[format]
+	if !ok {
+		c.SetMessage(fmt.Sprintf("Unknown bookmark format %q, use gemtext, gophermap, html or json", format), true)
+		c.DrawMessage()
+		return
+	}
+	if strings.HasPrefix(path, "~") {
+		path = homePath() + path[1:]
+	}
+
+	if direction == "export" {
+		data, err := c.BookMarks.Export(format)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		if path == "" {
+			path, _ = findAvailableFileName(c.Options["savelocation"], "bookmarks."+ext)
+		}
+		err = ioutil.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			c.SetMessage("Error writing file: "+err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		c.SetMessage(fmt.Sprintf("%d bookmarks exported to: %s", len(c.BookMarks.Links), path), false)
+		c.DrawMessage()
+		return
+	}
+
+	if path == "" {
+		c.SetMessage(syntaxErrorMessage("BOOKMARKS"), true)
+		c.DrawMessage()
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		c.SetMessage("Error reading file: "+err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	added, skipped, err := c.BookMarks.Import(format, string(data))
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.SetMessage(fmt.Sprintf("Imported %d bookmarks, skipped %d already bookmarked", added, skipped), false)
+	err = saveConfig()
+	if err != nil {
+		c.SetMessage("Error saving bookmarks to file", true)
+	}
+	if c.BookMarks.IsOpen {
+		c.Draw()
+	} else {
+		c.DrawMessage()
+	}
+}
+
+// SaveSession saves the open tabs, their history and scroll
+// positions as the session with the given name
+func (c *client) SaveSession(name string) error {
+	err := MakeSession(c.Tabs, c.Tab).Write(name)
+	if err != nil {
+		return err
+	}
+	c.Session = name
+	return nil
+}
+
+// LoadSession replaces the open tabs with those of the
+// session with the given name
+func (c *client) LoadSession(name string) error {
+	s, err := ReadSession(name)
+	if err != nil {
+		return err
+	}
+	c.GetSizeOnce()
+	tabs, tab := s.Restore(c.Width-1, (c.Options["theme"] == "color"))
+	c.Tabs = tabs
+	c.Session = name
+	c.SwitchTab(tab)
+	return nil
+}
+
+// sessionCommand handles the listing, saving, loading and
+// deleting of named sessions
+func (c *client) sessionCommand(values []string) {
+	if len(values) == 0 || strings.ToLower(values[0]) == "list" {
+		names, err := ListSessions()
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+		} else if len(names) == 0 {
+			c.SetMessage("There are no saved sessions", false)
+		} else {
+			c.SetMessage(fmt.Sprintf("Sessions (current: %s): %s", c.Session, strings.Join(names, ", ")), false)
+		}
+		c.DrawMessage()
+		return
+	}
+
+	var msg string
+	var err error
+	switch sub := strings.ToLower(values[0]); {
+	case sub == "save" && len(values) == 1:
+		err = c.SaveSession(c.Session)
+		msg = fmt.Sprintf("Session saved as %q", c.Session)
+	case sub == "save" && len(values) == 2:
+		err = c.SaveSession(values[1])
+		msg = fmt.Sprintf("Session saved as %q", values[1])
+	case sub == "load" && len(values) == 2:
+		err = c.LoadSession(values[1])
+		msg = fmt.Sprintf("Session %q loaded", values[1])
+	case sub == "delete" && len(values) == 2:
+		err = DeleteSession(values[1])
+		msg = fmt.Sprintf("Session %q deleted", values[1])
+	default:
+		c.SetMessage(syntaxErrorMessage("SESSION"), true)
+		c.DrawMessage()
+		return
 	}
-}
 
-func (c *client) handleGemini(u Url) {
-	capsule, err := gemini.Visit(u.Host, u.Port, u.Resource, &c.Certs)
 	if err != nil {
 		c.SetMessage(err.Error(), true)
 		c.DrawMessage()
 		return
 	}
-	go saveConfig()
-	switch capsule.Status {
-	case 1:
-		// Query
-		c.search("", u.Full, capsule.Content)
-	case 2:
-		// Success
-		if capsule.MimeMaj == "text" || (c.Options["showimages"] == "true" && capsule.MimeMaj == "image") {
-			u.Mime = capsule.MimeMin
-			pg := MakePage(u, capsule.Content, capsule.Links)
-			pg.FileType = capsule.MimeMaj
-			pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
-			c.PageState.Add(pg)
-			c.SetPercentRead()
-			c.ClearMessage()
-			c.SetHeaderUrl()
-			c.Draw()
-		} else {
-			c.SetMessage("The file is non-text: writing to disk...", false)
+	c.SetMessage(msg, false)
+	c.DrawMessage()
+}
+
+// searchesCommand saves the search that produced the current
+// page, deletes a saved search, or runs one by name
+func (c *client) searchesCommand(values []string) {
+	sub := strings.ToLower(values[0])
+	switch {
+	case sub == "save" && len(values) == 2:
+		if c.PageState.Length < 1 {
+			c.SetMessage("There is no page of search results to save", true)
 			c.DrawMessage()
-			nameSplit := strings.Split(u.Resource, "/")
-			filename := nameSplit[len(nameSplit)-1]
-			c.saveFileFromData(capsule.Content, filename)
+			return
 		}
-	case 3:
-		// Redirect
-		lowerRedirect := strings.ToLower(capsule.Content)
-		lowerOriginal := strings.ToLower(u.Full)
-		if strings.Replace(lowerRedirect, lowerOriginal, "", 1) == "/" {
-			c.Visit(capsule.Content)
-		} else {
-			if !strings.Contains(capsule.Content, "://") {
-				lnk, lnkErr := gemini.HandleRelativeUrl(capsule.Content, u.Full)
-				if lnkErr == nil {
-					capsule.Content = lnk
-				}
-			}
+		err := c.Searches.Save(values[1], c.PageState.History[c.PageState.Position].Location)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		c.SetMessage(fmt.Sprintf("Search saved as %q", values[1]), false)
+		c.DrawMessage()
+	case sub == "delete" && len(values) == 2:
+		i, ok := c.Searches.Find(values[1])
+		if !ok {
+			c.SetMessage(fmt.Sprintf("There is no saved search named %q", values[1]), true)
+			c.DrawMessage()
+			return
+		}
+		err := c.Searches.Delete(i)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		c.SetMessage(fmt.Sprintf("Saved search %q deleted", values[1]), false)
+		c.DrawMessage()
+	case len(values) == 1:
+		i, ok := c.Searches.Find(values[0])
+		if !ok {
+			c.SetMessage(fmt.Sprintf("There is no saved search named %q", values[0]), true)
+			c.DrawMessage()
+			return
+		}
+		c.runSavedSearch(i)
+	default:
+		c.SetMessage(syntaxErrorMessage("SEARCHES"), true)
+		c.DrawMessage()
+	}
+}
 
-			c.SetMessage(fmt.Sprintf("Follow redirect (y/n): %s?", capsule.Content), false)
+// searchesAction carries out an action from the saved
+// searches page, either "run/<name>" or "delete/<name>" with
+// the name path escaped
+func (c *client) searchesAction(action string) {
+	parts := strings.SplitN(action, "/", 2)
+	num, ok := -1, false
+	if len(parts) == 2 {
+		name, _ := url.PathUnescape(parts[1])
+		num, ok = c.Searches.Find(name)
+	}
+	if !ok {
+		c.SetMessage(fmt.Sprintf("%q is not a known about page", "about:searches/"+action), true)
+		c.DrawMessage()
+		return
+	}
+	switch parts[0] {
+	case "run":
+		c.runSavedSearch(num)
+	case "delete":
+		err := c.Searches.Delete(num)
+		if err != nil {
+			c.SetMessage(err.Error(), true)
 			c.DrawMessage()
-			ch := cui.Getch()
-			if ch == 'y' || ch == 'Y' {
-				c.Visit(capsule.Content)
-			} else {
-				c.SetMessage("Redirect aborted", false)
-				c.DrawMessage()
-			}
+			return
+		}
+		content, links := c.Searches.Render()
+		c.replaceAboutPage("searches", content, links)
+		c.ClearMessage()
+		c.Draw()
+	default:
+		c.SetMessage(fmt.Sprintf("%q is not a known about page", "about:searches/"+action), true)
+		c.DrawMessage()
+	}
+}
+
+// enginesCommand adds or deletes a search engine, saving the
+// engines to the config file
+func (c *client) enginesCommand(values []string) {
+	var msg string
+	var err error
+	switch sub := strings.ToLower(values[0]); {
+	case sub == "add" && len(values) >= 3:
+		err = c.Engines.Add(values[1], values[2], strings.Join(values[3:], " "))
+		msg = fmt.Sprintf("Search engine %q added", strings.ToLower(values[1]))
+	case sub == "delete" && len(values) == 2:
+		err = c.Engines.Delete(values[1])
+		msg = fmt.Sprintf("Search engine %q deleted", strings.ToLower(values[1]))
+	default:
+		c.SetMessage(syntaxErrorMessage("ENGINES"), true)
+		c.DrawMessage()
+		return
+	}
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	if saveConfig() != nil {
+		c.SetMessage("Error saving search engines to file", true)
+		c.DrawMessage()
+		return
+	}
+	c.SetMessage(msg, false)
+	c.DrawMessage()
+}
+
+// enginesAction carries out an action from the search engines
+// page, either "search/<keyword>" or "delete/<keyword>"
+func (c *client) enginesAction(action string) {
+	parts := strings.SplitN(action, "/", 2)
+	var engine SearchEngine
+	ok := false
+	if len(parts) == 2 {
+		engine, ok = c.Engines.Find(parts[1])
+	}
+	if !ok {
+		c.SetMessage(fmt.Sprintf("%q is not a known about page", "about:engines/"+action), true)
+		c.DrawMessage()
+		return
+	}
+	switch parts[0] {
+	case "search":
+		c.search("", engine.Url, "Search "+engine.Name)
+	case "delete":
+		err := c.Engines.Delete(engine.Keyword)
+		if err == nil {
+			err = saveConfig()
+		}
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		content, links := c.Engines.Render(c.Options["searchengine"])
+		c.replaceAboutPage("engines", content, links)
+		c.SetMessage(fmt.Sprintf("Search engine %q deleted", engine.Keyword), false)
+		c.Draw()
+	default:
+		c.SetMessage(fmt.Sprintf("%q is not a known about page", "about:engines/"+action), true)
+		c.DrawMessage()
+	}
+}
+
+// runSavedSearch requests the results of the saved search at
+// index i from the network and reports which of them are new
+// since it last ran
+func (c *client) runSavedSearch(i int) {
+	search := c.Searches.Saved[i]
+	pos := c.PageState.Position
+	c.refresh = true
+	c.Visit(search.Url)
+	c.refresh = false
+	if c.PageState.Position == pos {
+		// The search failed, and has said why. A search
+		// that redirected has added the page it ended on.
+		return
+	}
+	fresh, err := c.Searches.Update(i, c.PageState.History[c.PageState.Position].Links)
+	if err != nil {
+		c.SetMessage("Error saving search results to file", true)
+		c.DrawMessage()
+		return
+	}
+	switch {
+	case search.LastRun.IsZero():
+		c.SetMessage(fmt.Sprintf("Saved search %q: %d results", search.Name, len(c.PageState.History[c.PageState.Position].Links)), false)
+	case len(fresh) == 0:
+		c.SetMessage(fmt.Sprintf("Saved search %q: no new results since %s", search.Name, search.LastRun.Format("2006-01-02 15:04")), false)
+	default:
+		ids := make([]string, len(fresh))
+		for n, id := range fresh {
+			ids[n] = fmt.Sprintf("[%d]", id)
 		}
+		c.SetMessage(fmt.Sprintf("Saved search %q: %d new results since %s: %s", search.Name, len(fresh), search.LastRun.Format("2006-01-02 15:04"), strings.Join(ids, " ")), false)
+	}
+	c.DrawMessage()
+}
+
+// Quit exits bombadillo, saving the session first if the
+// 'savesession' setting is on
+func (c *client) Quit(code int) {
+	if c.Options["savesession"] == "true" {
+		_ = c.SaveSession(c.Session)
 	}
+	cui.Exit(code, "")
 }
 
 func (c *client) handleTelnet(u Url) {
@@ -1082,7 +2857,7 @@ func (c *client) handleLocal(u Url) {
 		pg.FileType = "image"
 	}
 	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
-	c.PageState.Add(pg)
+	c.addPage(pg)
 	c.SetPercentRead()
 	c.ClearMessage()
 	c.SetHeaderUrl()
@@ -1090,35 +2865,275 @@ func (c *client) handleLocal(u Url) {
 }
 
 func (c *client) handleFinger(u Url) {
-	content, err := finger.Finger(u.Host, u.Port, u.Resource)
+	resp, err := c.retrieve(u, func(ctx context.Context) ([]byte, error) {
+		content, err := finger.Finger(ctx, u.Host, u.Port, u.Resource)
+		return []byte(content), err
+	}, nil)
 	if err != nil {
 		c.SetMessage(err.Error(), true)
 		c.DrawMessage()
 		return
 	}
-	pg := MakePage(u, content, []string{})
+	pg := MakePage(u, string(resp), []string{})
 	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
-	c.PageState.Add(pg)
+	c.addPage(pg)
+	c.SetPercentRead()
+	c.ClearMessage()
+	c.SetHeaderUrl()
+	c.Draw()
+}
+
+// handleAbout displays the pages that are generated by
+// the client itself
+func (c *client) handleAbout(u Url) {
+	var content string
+	var links []string
+	switch {
+	case u.Resource == "history":
+		content, links = c.History.Render()
+	case u.Resource == "linkcheck":
+		content, links = c.LinkCheck.Render()
+	case u.Resource == "certs":
+		current := ""
+		if c.PageState.Position >= 0 && c.PageState.History[c.PageState.Position].Location.Scheme == "gemini" {
+			current = strings.ToLower(c.PageState.History[c.PageState.Position].Location.Host)
+		}
+		content, links = renderCerts(&c.Certs, current)
+	case strings.HasPrefix(u.Resource, "certs/chain/"):
+		var err error
+		content, err = renderChain(&c.Certs, u.Resource[12:])
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+	case strings.HasPrefix(u.Resource, "certs/"):
+		c.certsAction(u.Resource[6:])
+		return
+	case strings.HasPrefix(u.Resource, "linkcheck/"):
+		c.linkCheckAction(u.Resource[10:])
+		return
+	case u.Resource == "searches":
+		content, links = c.Searches.Render()
+	case strings.HasPrefix(u.Resource, "searches/"):
+		c.searchesAction(u.Resource[9:])
+		return
+	case u.Resource == "engines":
+		content, links = c.Engines.Render(c.Options["searchengine"])
+	case strings.HasPrefix(u.Resource, "engines/"):
+		c.enginesAction(u.Resource[8:])
+		return
+	default:
+		c.SetMessage(fmt.Sprintf("%q is not a known about page", u.Full), true)
+		c.DrawMessage()
+		return
+	}
+	pg := MakePage(u, content, links)
+	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+	c.addPage(pg)
 	c.SetPercentRead()
 	c.ClearMessage()
 	c.SetHeaderUrl()
 	c.Draw()
 }
 
+// checkBookmarks starts checking every bookmark in the
+// background and shows the report
+func (c *client) checkBookmarks() {
+	titles := make([]string, 0, len(c.BookMarks.Links))
+	urls := make([]Url, 0, len(c.BookMarks.Links))
+	for i, link := range c.BookMarks.Links {
+		u, err := MakeUrl(link)
+		if err != nil {
+			continue
+		}
+		titles = append(titles, c.BookMarks.Titles[i])
+		urls = append(urls, u)
+	}
+	ctx := stream.WithMaxSize(context.Background(), c.maxBodySize())
+	err := c.LinkCheck.Start(ctx, titles, urls, &c.Certs, func(problems int) {
+		c.post(func() {
+			c.SetMessage(fmt.Sprintf("Bookmark check finished, %d problems found: see about:linkcheck", problems), problems > 0)
+			c.DrawMessage()
+		})
+	})
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.Visit("about:linkcheck")
+}
+
+// linkCheckAction carries out an action from the bookmark
+// check report, either "update/<url>" or "delete/<url>" with
+// the url path escaped, then redraws the report in place
+func (c *client) linkCheckAction(action string) {
+	parts := strings.SplitN(action, "/", 2)
+	key := ""
+	if len(parts) == 2 {
+		key, _ = url.PathUnescape(parts[1])
+	}
+	p, err := c.LinkCheck.Problem(key)
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	index := -1
+	for i, link := range c.BookMarks.Links {
+		if bookmarkKey(link) == p.Link {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		c.LinkCheck.Resolve(p.Link)
+		c.SetMessage(fmt.Sprintf("%q is no longer bookmarked", p.Link), true)
+		c.DrawMessage()
+		return
+	}
+
+	var msg string
+	switch {
+	case parts[0] == "update" && p.Target != "":
+		c.BookMarks.Links[index] = p.Target
+		msg = fmt.Sprintf("Bookmark %d updated to %s", index, p.Target)
+	case parts[0] == "delete":
+		msg, err = c.BookMarks.Delete(index)
+	default:
+		err = fmt.Errorf("Unknown bookmark check action %q", action)
+	}
+	if err == nil {
+		err = saveConfig()
+	}
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+	c.LinkCheck.Resolve(p.Link)
+
+	content, links := c.LinkCheck.Render()
+	c.replaceAboutPage("linkcheck", content, links)
+	c.SetMessage(msg, false)
+	c.Draw()
+}
+
+// pageInfo shows the url, type and link count of the current
+// page, along with how its certificate was verified
+func (c *client) pageInfo() {
+	if c.PageState.Position < 0 {
+		c.SetMessage("There is no page to show information about", true)
+		c.DrawMessage()
+		return
+	}
+	pg := c.PageState.History[c.PageState.Position]
+	info := []string{pg.Location.Full}
+	if host := idn.ToUnicode(pg.Location.Host); host != pg.Location.Host {
+		info = append(info, "Host: "+host)
+	}
+	if pg.FileType != "" && pg.Location.Mime != "" && pg.Location.Scheme == "gemini" {
+		info = append(info, pg.FileType+"/"+pg.Location.Mime)
+	} else if pg.FileType != "" {
+		info = append(info, pg.FileType)
+	}
+	info = append(info, fmt.Sprintf("%d links", len(pg.Links)))
+	if pg.Security != "" {
+		info = append(info, pg.Security)
+	}
+	c.SetMessage(strings.Join(info, " | "), false)
+	c.DrawMessage()
+}
+
+// certsAction carries out an action from the certificate
+// manager page, either "purge/<host>" or "pin/<host>", then
+// redraws the page in place
+func (c *client) certsAction(action string) {
+	parts := strings.SplitN(action, "/", 2)
+	if len(parts) < 2 {
+		c.SetMessage(fmt.Sprintf("Unknown certificate action %q", action), true)
+		c.DrawMessage()
+		return
+	}
+	host := parts[1]
+
+	var msg string
+	var err error
+	switch parts[0] {
+	case "purge":
+		err = c.Certs.Purge(host)
+		msg = fmt.Sprintf("The certificate for %q has been purged", host)
+	case "pin":
+		err = c.Certs.Pin(host)
+		msg = fmt.Sprintf("The certificate for %q has been pinned", host)
+	default:
+		err = fmt.Errorf("Unknown certificate action %q", action)
+	}
+	if err == nil {
+		err = saveConfig()
+	}
+	if err != nil {
+		c.SetMessage(err.Error(), true)
+		c.DrawMessage()
+		return
+	}
+
+	content, links := renderCerts(&c.Certs, "")
+	c.replaceAboutPage("certs", content, links)
+	c.SetMessage(msg, false)
+	c.Draw()
+}
+
+// replaceAboutPage shows an about page after an action on it.
+// The page replaces the current page if that is the same about
+// page, so that the action does not add to the history.
+func (c *client) replaceAboutPage(resource, content string, links []string) {
+	pg := MakePage(Url{Scheme: "about", Resource: resource, Full: "about:" + resource}, content, links)
+	pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
+	if c.PageState.Position >= 0 && c.PageState.History[c.PageState.Position].Location.Full == pg.Location.Full {
+		pg.ScrollPosition = c.PageState.History[c.PageState.Position].ScrollPosition
+		c.PageState.History[c.PageState.Position] = pg
+	} else {
+		c.addPage(pg)
+	}
+	c.SetPercentRead()
+	c.SetHeaderUrl()
+}
+
 func (c *client) handleWeb(u Url) {
 	wm := strings.ToLower(c.Options["webmode"])
 	switch wm {
 	case "lynx", "w3m", "elinks":
-		if http.IsTextFile(u.Full) {
-			page, err := http.Visit(wm, u.Full, c.Width-1)
-			if err != nil {
+		var isText bool
+		err := c.load(func(ctx context.Context) error {
+			isText = http.IsTextFile(ctx, u.Full)
+			return nil
+		})
+		if err != nil {
+			c.SetMessage(err.Error(), true)
+			c.DrawMessage()
+			return
+		}
+		if isText {
+			var page http.Page
+			err := c.load(func(ctx context.Context) error {
+				var err error
+				page, err = http.Visit(ctx, wm, u.Full, c.Width-1)
+				return err
+			})
+			if err == errLoadCancelled {
+				c.SetMessage(err.Error(), true)
+				c.DrawMessage()
+				return
+			} else if err != nil {
 				c.SetMessage(fmt.Sprintf("%s error: %s", wm, err.Error()), true)
 				c.DrawMessage()
 				return
 			}
 			pg := MakePage(u, page.Content, page.Links)
 			pg.WrapContent(c.Width-1, (c.Options["theme"] == "color"))
-			c.PageState.Add(pg)
+			c.addPage(pg)
 			c.SetPercentRead()
 			c.ClearMessage()
 			c.SetHeaderUrl()
@@ -1218,10 +3233,57 @@ func (c *client) ScrollForSearch(amount int) {
 // MakeClient returns a client struct and names the client after
 // the string that is passed in
 func MakeClient(name string) *client {
-	c := client{0, 0, defaultOptions, "", false, MakePages(), MakeBookmarks(), MakeHeadbar(name), MakeFootbar(), gemini.MakeTofuDigest()}
+	pages := MakePages()
+	c := client{0, 0, defaultOptions, "", false, &pages, []*Pages{&pages}, 0, MakeBookmarks(), MakeHeadbar(name), MakeFootbar(), gemini.MakeTofuDigest(), gemini.MakeIdentityStore(), MakeHistoryStore(), "default", cache.MakeCache(0, 0), LinkChecker{}, MakeSearchStore(), MakeSearchEngines(), make([]string, 0, 5), false, nil, sync.Mutex{}, make(chan func(), 16)}
 	return &c
 }
 
+// aboutAction reports whether link is an about: url that
+// changes something, such as deleting a bookmark, rather than
+// a page that only shows something
+func aboutAction(link string) bool {
+	if !strings.HasPrefix(link, "about:") {
+		return false
+	}
+	for _, prefix := range aboutActions {
+		if strings.HasPrefix(link[6:], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectAllowed reports whether a redirect from one url to
+// another may be followed without asking, given the value of
+// the 'followredirects' setting
+func redirectAllowed(setting string, from, to Url) bool {
+	sameScheme := from.Scheme == to.Scheme
+	sameHost := sameScheme && strings.EqualFold(from.Host, to.Host) && from.Port == to.Port
+	switch setting {
+	case "crossscheme":
+		return true
+	case "crosshost":
+		return sameScheme
+	case "samehost":
+		return sameHost
+	default:
+		return false
+	}
+}
+
+// uploadMime returns the mime type of a file to be uploaded,
+// based on its extension
+func uploadMime(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gmi" || ext == ".gemini" {
+		return "text/gemini"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return strings.TrimSpace(strings.SplitN(t, ";", 2)[0])
+	}
+	return "application/octet-stream"
+}
+
 func findAvailableFileName(fpath, fname string) (string, error) {
 	savePath := filepath.Join(fpath, fname)
 	_, fileErr := os.Stat(savePath)
@@ -1239,6 +3301,7 @@ func findAvailableFileName(fpath, fname string) (string, error) {
 	return savePath, nil
 }
 
+
 func syntaxErrorMessage(action string) string {
 	if val, ok := ERRS[action]; ok {
 		return fmt.Sprintf("Incorrect syntax. Try: %s", val)
@@ -1246,6 +3309,16 @@ func syntaxErrorMessage(action string) string {
 	return fmt.Sprintf("Unknown command %q", action)
 }
 
+// updateCABundle loads the certificate authorities in the
+// file at path, alongside those of the system. "none" uses
+// the system's certificate authorities alone.
+func updateCABundle(path string) error {
+	if strings.ToLower(path) == "none" {
+		path = ""
+	}
+	return gemini.LoadCABundle(path)
+}
+
 func updateTimeouts(timeoutString string) error {
 	sec, err := strconv.Atoi(timeoutString)
 	if err != nil {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_aboutAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string
+		expects bool
+	}{
+		{"Bookmark check delete", "about:linkcheck/delete/1", true},
+		{"Bookmark check update", "about:linkcheck/update/1", true},
+		{"Bookmark check report", "about:linkcheck", false},
+		{"Certificate purge", "about:certs/purge/example.org", true},
+		{"Certificate pin", "about:certs/pin/example.org", true},
+		{"Certificate chain", "about:certs/chain/example.org", false},
+		{"Certificate manager", "about:certs", false},
+		{"Saved search run", "about:searches/run/0", true},
+		{"Saved search delete", "about:searches/delete/0", true},
+		{"Saved searches", "about:searches", false},
+		{"Search engine search", "about:engines/search/vs", true},
+		{"Search engine delete", "about:engines/delete/vs", true},
+		{"Search engines", "about:engines", false},
+		{"History page", "about:history", false},
+		{"Action path on a remote host", "gemini://example.org:1965/linkcheck/delete/1", false},
+		{"Action path inside a remote url", "gopher://example.org:70/1/about:linkcheck/delete/1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := aboutAction(tt.link)
+			if actual != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %t\nactual  %t", tt.name, tt.expects, actual)
+			}
+		})
+	}
+}
+
+func Test_blockedLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		link    string
+		expects bool
+	}{
+		{"Action from an about page", "about:linkcheck", "about:linkcheck/delete/1", false},
+		{"Action from a remote page", "gemini://example.org:1965/", "about:linkcheck/delete/1", true},
+		{"Action with no page open", "", "about:linkcheck/delete/1", true},
+		{"About page from a remote page", "gemini://example.org:1965/", "about:history", false},
+		{"Remote link from a remote page", "gemini://example.org:1965/", "gemini://example.org:1965/next", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := MakePages()
+			if tt.current != "" {
+				u, err := MakeUrl(tt.current)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pages.Add(MakePage(u, "", []string{tt.link}))
+			}
+			c := client{PageState: &pages}
+			actual := c.blockedLink(tt.link)
+			if actual != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %t\nactual  %t", tt.name, tt.expects, actual)
+			}
+		})
+	}
+}
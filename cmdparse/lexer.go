@@ -67,12 +67,7 @@ func (s *scanner) scanText() Token {
 	}
 
 	capInput := strings.ToUpper(buf.String())
-	switch capInput {
-	case "D", "DELETE", "A", "ADD", "W", "WRITE",
-		"S", "SET", "R", "RELOAD", "SEARCH",
-		"Q", "QUIT", "B", "BOOKMARKS", "H",
-		"HOME", "?", "HELP", "C", "CHECK",
-		"P", "PURGE", "JUMP", "J", "VERSION":
+	if IsAction(capInput) {
 		return Token{Action, capInput}
 	}
 
@@ -144,6 +139,23 @@ func (s *scanner) scan() Token {
 // + + +          F U N C T I O N S          + + + \\
 //--------------------------------------------------\\
 
+// IsAction reports whether word is one of the action words
+// that start a command
+func IsAction(word string) bool {
+	switch strings.ToUpper(word) {
+	case "D", "DELETE", "A", "ADD", "W", "WRITE",
+		"S", "SET", "R", "RELOAD", "SEARCH",
+		"Q", "QUIT", "B", "BOOKMARKS", "H",
+		"HOME", "?", "HELP", "C", "CHECK",
+		"P", "PURGE", "JUMP", "J", "VERSION",
+		"ID", "IDENTITY", "HISTORY", "TAB",
+		"SESSION", "CACHE", "CERTS", "INFO",
+		"UPLOAD", "SEARCHES", "ENGINES":
+		return true
+	}
+	return false
+}
+
 func NewScanner(r io.Reader) *scanner {
 	return &scanner{r: bufio.NewReader(r)}
 }
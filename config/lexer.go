@@ -118,10 +118,9 @@ func (s *scanner) scanKey() Token {
 		} else if ch == newline {
 			s.unread()
 			return Token{TOK_ERROR, "No value assigned to key"}
-		} else if ch == r_brace || ch == l_brace {
-			s.skipToEndOfLine()
-			return Token{TOK_ERROR, "Illegal brace character in key"}
 		} else {
+			// Braces are allowed after the first character,
+			// as they are in urls with IPv6 addresses
 			_, _ = buf.WriteRune(ch)
 		}
 	}
@@ -141,9 +140,6 @@ func (s *scanner) scanValue() Token {
 		} else if ch == newline {
 			s.unread()
 			break
-		} else if ch == r_brace || ch == l_brace {
-			s.skipToEndOfLine()
-			return Token{TOK_ERROR, "Illegal brace character in key"}
 		} else {
 			_, _ = buf.WriteRune(ch)
 		}
@@ -24,8 +24,12 @@ type Config struct {
 	Bookmarks struct {
 		Titles, Links []string
 	}
-	Settings []KeyValue
-	Certs    []KeyValue
+	BookmarkMeta []KeyValue
+	Settings     []KeyValue
+	Certs        []KeyValue
+	Identities   []KeyValue
+	// SearchEngines is nil when the file has no section for them
+	SearchEngines []KeyValue
 }
 
 type KeyValue struct {
@@ -78,6 +82,9 @@ func (p *Parser) Parse() (Config, error) {
 			p.row++
 		} else if t.kind == TOK_SECTION {
 			section = strings.ToUpper(t.val)
+			if section == "SEARCHENGINES" && c.SearchEngines == nil {
+				c.SearchEngines = []KeyValue{}
+			}
 		} else if t.kind == TOK_EOF {
 			break
 		} else if t.kind == TOK_KEY {
@@ -90,10 +97,16 @@ func (p *Parser) Parse() (Config, error) {
 			case "BOOKMARKS":
 				c.Bookmarks.Titles = append(c.Bookmarks.Titles, keyval.Value)
 				c.Bookmarks.Links = append(c.Bookmarks.Links, keyval.Key)
+			case "BOOKMARKMETA":
+				c.BookmarkMeta = append(c.BookmarkMeta, keyval)
 			case "CERTS":
 				c.Certs = append(c.Certs, keyval)
+			case "IDENTITIES":
+				c.Identities = append(c.Identities, keyval)
 			case "SETTINGS":
 				c.Settings = append(c.Settings, keyval)
+			case "SEARCHENGINES":
+				c.SearchEngines = append(c.SearchEngines, keyval)
 			}
 		} else if t.kind == TOK_ERROR {
 			return Config{}, fmt.Errorf("Error on row %d: %s", p.row, t.val)
@@ -0,0 +1,106 @@
+// Package cso looks up entries on CSO phone book servers with
+// the ph protocol, as linked to by gopher type 2 items
+package cso
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"tildegit.org/sloum/bombadillo/stream"
+)
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// Query sends query to the server at host and port and
+// returns the raw response
+func Query(ctx context.Context, host, port, query string) ([]byte, error) {
+	if host == "" || port == "" {
+		return []byte{}, fmt.Errorf("Incomplete request url")
+	}
+	query = strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(query))
+	if query == "" {
+		return []byte{}, fmt.Errorf("An empty query cannot be sent")
+	}
+
+	dialer := net.Dialer{Timeout: time.Duration(5) * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return []byte{}, err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	_, err = conn.Write([]byte(fmt.Sprintf("query %s\r\nquit\r\n", query)))
+	if err != nil {
+		return []byte{}, err
+	}
+	return stream.ReadAll(ctx, conn)
+}
+
+// Parse renders the response to a query as a list of records,
+// each field on its own line. A response without records is
+// returned as an error holding the server's message.
+func Parse(resp []byte) (string, error) {
+	records := make([][][2]string, 0, 5)
+	indexes := make(map[string]int)
+	message := ""
+	for _, ln := range strings.Split(string(resp), "\n") {
+		ln = strings.TrimRight(ln, "\r")
+		fields := strings.SplitN(ln, ":", 4)
+		code, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if code >= 0 || len(fields) < 4 {
+			// Replies other than records describe the
+			// result, the last is kept for errors
+			if code >= 300 && len(fields) > 1 {
+				message = strings.TrimSpace(strings.Join(fields[1:], ":"))
+			}
+			continue
+		}
+		// Records are sent as -200:index:field:value, with
+		// an empty field name continuing the previous field
+		i, ok := indexes[fields[1]]
+		if !ok {
+			i = len(records)
+			indexes[fields[1]] = i
+			records = append(records, [][2]string{})
+		}
+		name, value := strings.TrimSpace(fields[2]), strings.TrimSpace(fields[3])
+		if last := len(records[i]) - 1; name == "" && last >= 0 {
+			records[i][last][1] += " " + value
+			continue
+		}
+		records[i] = append(records[i], [2]string{name, value})
+	}
+
+	if len(records) == 0 {
+		if message == "" {
+			message = "No matches to your query"
+		}
+		return "", fmt.Errorf("%s", message)
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Matching records: %d\n", len(records)))
+	for i, rec := range records {
+		width := 0
+		for _, f := range rec {
+			if len(f[0]) > width {
+				width = len(f[0])
+			}
+		}
+		out.WriteString(fmt.Sprintf("\nRecord %d\n", i+1))
+		for _, f := range rec {
+			out.WriteString(fmt.Sprintf("      %*s: %s\n", width, f[0], f[1]))
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,73 @@
+package cso
+
+import (
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects string
+		fails   bool
+	}{
+		{
+			"Records with continued fields",
+			"102:There were 2 matches to your request.\r\n" +
+				"-200:1:        name:Jo Smith\r\n" +
+				"-200:1:         url:http://example.org/~jo\r\n" +
+				"-200:2:        name:Al Jones\r\n" +
+				"-200:2:     address:1 Main St\r\n" +
+				"-200:2:            :Springfield\r\n" +
+				"200:Ok.\r\n",
+			"Matching records: 2\n" +
+				"\nRecord 1\n" +
+				"      name: Jo Smith\n" +
+				"       url: http://example.org/~jo\n" +
+				"\nRecord 2\n" +
+				"         name: Al Jones\n" +
+				"      address: 1 Main St Springfield\n",
+			false,
+		},
+		{
+			"Records sent out of order",
+			"-200:2:name:Al Jones\n-200:1:name:Jo Smith\n-200:2:email:al@example.org\n200:Ok.\n",
+			"Matching records: 2\n" +
+				"\nRecord 1\n" +
+				"       name: Al Jones\n" +
+				"      email: al@example.org\n" +
+				"\nRecord 2\n" +
+				"      name: Jo Smith\n",
+			false,
+		},
+		{
+			"Error from the server",
+			"501:No matches to your query.\r\n",
+			"No matches to your query.",
+			true,
+		},
+		{
+			"Last error is kept",
+			"598:name:Unknown field.\r\n599:Syntax error.\r\n",
+			"Syntax error.",
+			true,
+		},
+		{
+			"Empty response",
+			"",
+			"No matches to your query",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := Parse([]byte(tt.input))
+			if err != nil {
+				actual = err.Error()
+			}
+			if actual != tt.expects || (err != nil) != tt.fails {
+				t.Errorf("Test failed - %s\nexpects %q, error %t\nactual  %q, error %v", tt.name, tt.expects, tt.fails, actual, err)
+			}
+		})
+	}
+}
@@ -5,10 +5,20 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"unicode"
 
 	"tildegit.org/sloum/bombadillo/termios"
 )
 
+// stdin is shared by all keyboard input so that input read
+// ahead into its buffer is never lost between calls
+var stdin = bufio.NewReader(os.Stdin)
+
+// readTimeout is the read timeout the terminal is set to, in
+// tenths of a second, so that it is only changed when needed
+var readTimeout uint8
+
 var Shapes = map[string]string{
 	"walll":    "╎",
 	"wallr":    " ",
@@ -58,6 +68,8 @@ func Exit(exitCode int, msg string) {
 // InitTerm sets the terminal modes appropriate for Bombadillo
 func InitTerm() {
 	termios.SetCharMode()
+	termios.SetReadTimeout(0)
+	readTimeout = 0
 	Tput("smcup")          // use alternate screen
 	Tput("rmam")           // turn off line wrapping
 	fmt.Print("\033[?25l") // hide cursor
@@ -68,6 +80,7 @@ func CleanupTerm() {
 	moveCursorToward("down", 500)
 	moveCursorToward("right", 500)
 	termios.SetLineMode()
+	termios.SetReadTimeout(0)
 
 	fmt.Print("\n")
 	fmt.Print("\033[?25h") // reenables cursor blinking
@@ -92,21 +105,37 @@ func Clear(dir string) {
 }
 
 func Getch() rune {
-	reader := bufio.NewReader(os.Stdin)
-	char, _, err := reader.ReadRune()
+	setReadTimeout(0)
+	char, _, err := stdin.ReadRune()
 	if err != nil {
 		return '@'
 	}
 	return char
 }
 
+// GetchUnless reads a single character in the same way as
+// Getch, but gives up without one once ready returns true.
+// Ready is checked about every tenth of a second. The terminal
+// is left with its read timeout, so that waiting for the next
+// key does not change it again.
+func GetchUnless(ready func() bool) (rune, bool) {
+	setReadTimeout(1)
+	for !ready() {
+		char, _, err := stdin.ReadRune()
+		if err == nil {
+			return char, true
+		}
+	}
+	return 0, false
+}
+
 func GetLine(prefix string) (string, error) {
+	setReadTimeout(0)
 	termios.SetLineMode()
 	defer termios.SetCharMode()
 
-	reader := bufio.NewReader(os.Stdin)
 	fmt.Print(prefix)
-	text, err := reader.ReadString('\n')
+	text, err := stdin.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
@@ -114,6 +143,136 @@ func GetLine(prefix string) (string, error) {
 	return text[:len(text)-1], nil
 }
 
+// GetLineWithHistory reads a line of input in the same way as
+// GetLine, but the up and down arrow keys step through history,
+// which is ordered oldest first. Esc cancels the input, which
+// is returned as an empty string.
+func GetLineWithHistory(prefix string, history []string) (string, error) {
+	fmt.Print("\033[?25h") // show the cursor while typing
+	defer fmt.Print("\033[?25l")
+
+	setReadTimeout(0)
+	line := []rune{}
+	pos := len(history)
+	shown := 0
+	draw := func() {
+		// Earlier input is blanked with spaces rather than
+		// cleared, so that the colors of the line are kept
+		pad := shown - len(line)
+		if pad < 0 {
+			pad = 0
+		}
+		fmt.Printf("\r%s%s%s", prefix, string(line), strings.Repeat(" ", pad))
+		if pad > 0 {
+			moveCursorToward("left", pad)
+		}
+		shown = len(line)
+	}
+	draw()
+
+	for {
+		ch, _, err := stdin.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch ch {
+		case '\n', '\r':
+			return string(line), nil
+		case 127, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case 21:
+			// Ctrl-U clears the line
+			line = line[:0]
+		case 27:
+			// Arrow keys arrive as an escape sequence, a lone
+			// Esc cancels
+			if stdin.Buffered() == 0 {
+				return "", nil
+			}
+			if next, _, _ := stdin.ReadRune(); next != '[' && next != 'O' {
+				continue
+			}
+			key, _, _ := stdin.ReadRune()
+			if key == 'A' && pos > 0 {
+				pos--
+				line = []rune(history[pos])
+			} else if key == 'B' && pos < len(history) {
+				pos++
+				line = line[:0]
+				if pos < len(history) {
+					line = []rune(history[pos])
+				}
+			}
+		default:
+			if unicode.IsPrint(ch) {
+				line = append(line, ch)
+			}
+		}
+		draw()
+	}
+}
+
+// GetSecret reads a line of input in the same way as GetLine,
+// but does not echo the input to the screen
+func GetSecret(prefix string) (string, error) {
+	setReadTimeout(0)
+	termios.SetSecretMode()
+	defer termios.SetCharMode()
+
+	fmt.Print(prefix)
+	text, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return text[:len(text)-1], nil
+}
+
+// WaitForKey watches for one of the given keys to be pressed
+// until done is closed. It returns true if one of the keys was
+// pressed, any other input is discarded. Escape sequences, such
+// as those sent by the arrow keys, do not count as Esc.
+func WaitForKey(done <-chan struct{}, keys ...rune) bool {
+	setReadTimeout(1)
+	for {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+		char, _, err := stdin.ReadRune()
+		if err != nil {
+			// The read timed out without any input
+			continue
+		}
+		if char == 27 {
+			// Esc followed at once by more input is the
+			// start of an escape sequence, which is
+			// discarded
+			if _, err := stdin.Peek(1); err == nil {
+				_, _ = stdin.Discard(stdin.Buffered())
+				continue
+			}
+		}
+		for _, k := range keys {
+			if char == k {
+				return true
+			}
+		}
+	}
+}
+
+// setReadTimeout sets the read timeout of the terminal, see
+// termios.SetReadTimeout, unless it is already set to tenths
+func setReadTimeout(tenths uint8) {
+	if tenths != readTimeout {
+		termios.SetReadTimeout(tenths)
+		readTimeout = tenths
+	}
+}
+
 func Tput(opt string) {
 	cmd := exec.Command("tput", opt)
 	cmd.Stdin = os.Stdin
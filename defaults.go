@@ -45,17 +45,36 @@ var defaultOptions = map[string]string{
 	// the "configlocation" as follows:
 	// "configlocation": xdgConfigPath()
 
-	"configlocation": xdgConfigPath(),
-	"defaultscheme":  "gopher", // "gopher", "gemini", "http", "https"
-	"geminiblocks":   "block",  // "block", "alt", "neither", "both"
-	"homeurl":        "gopher://bombadillo.colorfield.space:70/1/user-guide.map",
-	"savelocation":   homePath(),
-	"searchengine":   "gopher://gopher.floodgap.com:70/7/v2/vs",
-	"showimages":     "true",
-	"telnetcommand":  "telnet",
-	"theme":          "normal", // "normal", "inverted", "color"
-	"timeout":        "15",     // connection timeout for gopher/gemini in seconds
-	"webmode":        "none",   // "none", "gui", "lynx", "w3m", "elinks"
+	"cabundle":        "none", // extra certificate authorities for gemini, a PEM file
+	"cachesize":       "50",   // largest size of the page cache in megabytes
+	"cachettl":        "0",    // minutes a cached page is used for, 0 to disable the cache
+	"configlocation":  xdgConfigPath(),
+	"defaultscheme":   "gopher", // "gopher", "gemini", "http", "https"
+	"followredirects": "none",   // "none", "samehost", "crosshost", "crossscheme"
+	"geminiblocks":    "block",  // "block", "alt", "neither", "both"
+	"geminitls":       "tofu",   // "tofu", "ca", "either"
+	"gophertls":       "off",    // "off", "opportunistic"
+	"homeurl":         "gopher://bombadillo.colorfield.space:70/1/user-guide.map",
+	"maxbodysize":     "100", // largest document to view in megabytes, 0 for no limit
+	"maxredirects":    "5",
+	"offline":         "false", // only show pages from the cache
+	"savelocation":    homePath(),
+	"savesession":     "false", // restore the open tabs on the next start
+	"searchengine":    "gopher://gopher.floodgap.com:70/7/v2/vs",
+	"showimages":      "true",
+	"telnetcommand":   "telnet",
+	"theme":           "normal", // "normal", "inverted", "color"
+	"timeout":         "15",     // connection timeout for gopher/gemini in seconds
+	"webmode":         "none",   // "none", "gui", "lynx", "w3m", "elinks"
+}
+
+// defaultSearchEngines are the engines available by keyword
+// until a user edits the list, which is then kept in
+// .bombadillo.ini. Http engines need a %s where the query goes.
+var defaultSearchEngines = []SearchEngine{
+	{"vs", "Veronica-2", "gopher://gopher.floodgap.com:70/7/v2/vs"},
+	{"k", "Kennedy", "gemini://kennedy.gemi.dev/search"},
+	{"ddg", "DuckDuckGo", "https://lite.duckduckgo.com/lite/?q=%s"},
 }
 
 // homePath will return the path to your home directory as a string
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"tildegit.org/sloum/bombadillo/cmdparse"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// SearchEngine is a search endpoint picked by its keyword.
+// Gopher, gemini, spartan and cso urls have the query added
+// the way their protocol expects. Http urls are templates,
+// with the query going in place of a '%s'.
+type SearchEngine struct {
+	Keyword string
+	Name    string
+	Url     string
+}
+
+// SearchEngines is the table of search engines, in the order
+// they were added
+type SearchEngines []SearchEngine
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Add puts an engine in the table, replacing any engine that
+// has the same keyword. Keywords are made of letters and
+// digits and cannot be a number or a command.
+func (s *SearchEngines) Add(keyword, uri, name string) error {
+	keyword = strings.ToLower(keyword)
+	if !validKeyword(keyword) {
+		return fmt.Errorf("%q cannot be used as a search engine keyword", keyword)
+	}
+	u, err := MakeUrl(uri)
+	if err != nil {
+		return fmt.Errorf("Invalid search engine url: %s", uri)
+	}
+	switch u.Scheme {
+	case "gopher", "gophers", "gemini", "spartan", "cso":
+	case "http", "https":
+		if strings.Count(uri, "%s") != 1 {
+			return fmt.Errorf("Http search engine urls need one '%%s' where the query goes")
+		}
+	default:
+		return fmt.Errorf("%q is not a supported search protocol", u.Scheme)
+	}
+	if name == "" {
+		name = keyword
+	}
+
+	engine := SearchEngine{keyword, name, uri}
+	if i, ok := s.index(keyword); ok {
+		(*s)[i] = engine
+	} else {
+		*s = append(*s, engine)
+	}
+	return nil
+}
+
+// Delete removes the engine with the given keyword
+func (s *SearchEngines) Delete(keyword string) error {
+	i, ok := s.index(keyword)
+	if !ok {
+		return fmt.Errorf("There is no search engine with the keyword %q", keyword)
+	}
+	*s = append((*s)[:i], (*s)[i+1:]...)
+	return nil
+}
+
+// Find returns the engine with the given keyword
+func (s SearchEngines) Find(keyword string) (SearchEngine, bool) {
+	if i, ok := s.index(keyword); ok {
+		return s[i], true
+	}
+	return SearchEngine{}, false
+}
+
+// Match checks whether a line entered at the command prompt
+// starts with an engine keyword, returning the engine and the
+// rest of the line as the query
+func (s SearchEngines) Match(entry string) (SearchEngine, string, bool) {
+	fields := strings.SplitN(strings.TrimSpace(entry), " ", 2)
+	engine, ok := s.Find(fields[0])
+	if !ok {
+		return engine, "", false
+	}
+	if len(fields) < 2 {
+		return engine, "", true
+	}
+	return engine, strings.TrimSpace(fields[1]), true
+}
+
+// Render returns the engine table as page content, along with
+// the slice of links. Each engine has a link that prompts for a
+// query and one that deletes it.
+func (s SearchEngines) Render(defaultEngine string) (string, []string) {
+	links := make([]string, 0, len(s)*2)
+	var out strings.Builder
+	out.WriteString("Search Engines\n\n")
+	out.WriteString(fmt.Sprintf("Default: %s\n\n", defaultEngine))
+	if len(s) == 0 {
+		out.WriteString("There are no search engines, use 'engines add [keyword] [url] [name]' to add one\n")
+		return out.String(), links
+	}
+	for _, engine := range s {
+		out.WriteString(fmt.Sprintf("%s (%s)\n", engine.Name, engine.Keyword))
+		out.WriteString(fmt.Sprintf("      %s\n", engine.Url))
+		links = append(links, "about:engines/search/"+engine.Keyword)
+		out.WriteString(fmt.Sprintf("%-5s Search\n", fmt.Sprintf("[%d]", len(links))))
+		links = append(links, "about:engines/delete/"+engine.Keyword)
+		out.WriteString(fmt.Sprintf("%-5s Delete\n\n", fmt.Sprintf("[%d]", len(links))))
+	}
+	return out.String(), links
+}
+
+// IniDump returns a string representing the engine table in
+// the format that .bombadillo.ini uses. The section is written
+// even when empty, so that deleted engines stay deleted.
+func (s SearchEngines) IniDump() string {
+	var out strings.Builder
+	out.WriteString("[SEARCHENGINES]\n")
+	for _, engine := range s {
+		out.WriteString(engine.Keyword)
+		out.WriteString("=")
+		out.WriteString(engine.Url)
+		out.WriteString(" ")
+		out.WriteString(engine.Name)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+func (s SearchEngines) index(keyword string) (int, bool) {
+	keyword = strings.ToLower(keyword)
+	for i, engine := range s {
+		if engine.Keyword == keyword {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// MakeSearchEngines returns a copy of the default engines
+func MakeSearchEngines() SearchEngines {
+	return append(SearchEngines{}, defaultSearchEngines...)
+}
+
+// parseEngineEntry reads an engine from its .bombadillo.ini
+// value, a url followed by the engine's name
+func parseEngineEntry(value string) (string, string) {
+	split := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if len(split) < 2 {
+		return split[0], ""
+	}
+	return split[0], strings.TrimSpace(split[1])
+}
+
+// searchUrl returns the url that sends query to a search
+// endpoint of the given scheme. Http endpoints are templates,
+// with the query going in place of a '%s' or on the end.
+func searchUrl(scheme, endpoint, query string) string {
+	switch scheme {
+	case "gopher", "gophers":
+		return fmt.Sprintf("%s\t%s", endpoint, query)
+	case "http", "https":
+		if strings.Contains(endpoint, "%s") {
+			return strings.Replace(endpoint, "%s", url.QueryEscape(query), 1)
+		}
+		return endpoint + url.QueryEscape(query)
+	default:
+		return fmt.Sprintf("%s?%s", endpoint, url.PathEscape(query))
+	}
+}
+
+// validKeyword reports whether keyword can be used for an
+// engine without hiding a command or a link number
+func validKeyword(keyword string) bool {
+	if keyword == "" || cmdparse.IsAction(keyword) {
+		return false
+	}
+	digits := true
+	for _, ch := range keyword {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') {
+			return false
+		} else if ch < '0' || ch > '9' {
+			digits = false
+		}
+	}
+	return !digits
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_SearchEngines_Add(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyword string
+		uri     string
+		title   string
+		expects SearchEngine
+		size    int
+		fails   bool
+	}{
+		{
+			"Gopher engine",
+			"gs",
+			"gopher://example.org:70/7/search",
+			"Gopher Search",
+			SearchEngine{"gs", "Gopher Search", "gopher://example.org:70/7/search"},
+			4,
+			false,
+		},
+		{
+			"Keyword in upper case with no name",
+			"GEM2",
+			"gemini://example.org/search",
+			"",
+			SearchEngine{"gem2", "gem2", "gemini://example.org/search"},
+			4,
+			false,
+		},
+		{
+			"Http template",
+			"wiki",
+			"https://en.wikipedia.org/w/index.php?search=%s",
+			"Wikipedia",
+			SearchEngine{"wiki", "Wikipedia", "https://en.wikipedia.org/w/index.php?search=%s"},
+			4,
+			false,
+		},
+		{
+			"Replaces the engine with the same keyword",
+			"vs",
+			"gopher://example.org:70/7/veronica",
+			"Veronica mirror",
+			SearchEngine{"vs", "Veronica mirror", "gopher://example.org:70/7/veronica"},
+			3,
+			false,
+		},
+		{"Short command as keyword", "w", "gemini://example.org/search", "", SearchEngine{}, 3, true},
+		{"Long command as keyword", "Search", "gemini://example.org/search", "", SearchEngine{}, 3, true},
+		{"Number as keyword", "12", "gemini://example.org/search", "", SearchEngine{}, 3, true},
+		{"Keyword with punctuation", "my-engine", "gemini://example.org/search", "", SearchEngine{}, 3, true},
+		{"Empty keyword", "", "gemini://example.org/search", "", SearchEngine{}, 3, true},
+		{"Http url without a '%s'", "web", "https://example.org/search?q=", "", SearchEngine{}, 3, true},
+		{"Http url with two '%s'", "web", "https://example.org/%s?q=%s", "", SearchEngine{}, 3, true},
+		{"Unsupported scheme", "fing", "finger://example.org/", "", SearchEngine{}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engines := MakeSearchEngines()
+			err := engines.Add(tt.keyword, tt.uri, tt.title)
+			if (err != nil) != tt.fails {
+				t.Fatalf("Test failed - %s\nexpects error %t\nactual  error %v", tt.name, tt.fails, err)
+			}
+			engine, _ := engines.Find(tt.keyword)
+			if engine != tt.expects || len(engines) != tt.size {
+				t.Errorf("Test failed - %s\nexpects %v, %d engines\nactual  %v, %d engines", tt.name, tt.expects, tt.size, engine, len(engines))
+			}
+		})
+	}
+}
+
+func Test_searchUrl(t *testing.T) {
+	tests := []struct {
+		name     string
+		scheme   string
+		endpoint string
+		query    string
+		expects  string
+	}{
+		{"Gopher query after a tab", "gopher", "gopher://example.org:70/7/search", "a b?", "gopher://example.org:70/7/search\ta b?"},
+		{"Gophers query after a tab", "gophers", "gophers://example.org:70/7/search", "a b", "gophers://example.org:70/7/search\ta b"},
+		{"Http template", "https", "https://example.org/search?q=%s&lang=en", "a b&c", "https://example.org/search?q=a+b%26c&lang=en"},
+		{"Http endpoint without a template", "http", "http://example.org/search?q=", "a b", "http://example.org/search?q=a+b"},
+		{"Gemini query after a '?'", "gemini", "gemini://example.org/search", "a b?", "gemini://example.org/search?a%20b%3F"},
+		{"Spartan query after a '?'", "spartan", "spartan://example.org/search", "a/b", "spartan://example.org/search?a%2Fb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := searchUrl(tt.scheme, tt.endpoint, tt.query)
+			if actual != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %s", tt.name, tt.expects, actual)
+			}
+		})
+	}
+}
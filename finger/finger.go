@@ -1,29 +1,31 @@
 package finger
 
 import (
-	"fmt"
-	"io/ioutil"
+	"context"
 	"net"
 	"time"
+
+	"tildegit.org/sloum/bombadillo/stream"
 )
 
-func Finger(host, port, resource string) (string, error) {
-	addr := fmt.Sprintf("%s:%s", host, port)
+func Finger(ctx context.Context, host, port, resource string) (string, error) {
+	addr := net.JoinHostPort(host, port)
 
-	timeOut := time.Duration(3) * time.Second
-	conn, err := net.DialTimeout("tcp", addr, timeOut)
+	dialer := net.Dialer{Timeout: time.Duration(3) * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return "", err
 	}
 
 	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
 	_, err = conn.Write([]byte(resource + "\r\n"))
 	if err != nil {
 		return "", err
 	}
 
-	result, err := ioutil.ReadAll(conn)
+	result, err := stream.ReadAll(ctx, conn)
 	if err != nil {
 		return "", err
 	}
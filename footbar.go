@@ -39,8 +39,8 @@ func (f *Footbar) SetPageType(t string) {
 
 // Render returns a string representing the visual display
 // of the bookmarks bar
-func (f *Footbar) Render(termWidth, position int, theme string) string {
-	pre := fmt.Sprintf("HST: (%2.2d) - - - %4s Read ", position+1, f.PercentRead)
+func (f *Footbar) Render(termWidth, position, tab, tabs int, theme string) string {
+	pre := fmt.Sprintf("TAB: %d/%d - HST: (%2.2d) - - - %4s Read ", tab+1, tabs, position+1, f.PercentRead)
 	out := "\033[0m%*.*s "
 	if theme == "inverse" {
 		out = "\033[7m%*.*s \033[0m"
@@ -1,16 +1,25 @@
 package gemini
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"tildegit.org/sloum/bombadillo/stream"
 )
 
 type Capsule struct {
@@ -21,13 +30,77 @@ type Capsule struct {
 	Links   []string
 }
 
+// TofuDigest holds the certificate fingerprint trusted for
+// each host. Fingerprints accepted for the current session
+// only are kept apart, and are never written to the config.
+// The certificate chain last presented by each host is kept
+// so that it can be inspected, along with how it was verified.
 type TofuDigest struct {
-	certs      map[string]string
+	certs    map[string]string
+	accepted map[string]CertInfo
+	chains   map[string][]*x509.Certificate
+	verified map[string]string
+}
+
+// CertInfo describes a certificate: its SHA-256 fingerprint,
+// subject and expiry, and when it was last presented
+type CertInfo struct {
+	Fingerprint string
+	Subject     string
+	Expires     time.Time
+	LastSeen    time.Time
+}
+
+// CertChangeError is returned when a known host presents a
+// valid certificate other than the one that is trusted for it.
+// When the trusted fingerprint was stored by an older version
+// it is SHA-1, and NewSHA1 holds the new certificate's SHA-1
+// fingerprint to compare it with.
+type CertChangeError struct {
+	Host    string
+	Old     CertInfo
+	New     CertInfo
+	NewSHA1 string
 }
 
+var statusMessages = map[int]string{
+	10: "Input",
+	11: "Sensitive Input",
+	20: "Success",
+	30: "Temporary Redirect",
+	31: "Permanent Redirect",
+	40: "Temporary Failure",
+	41: "Server Unavailable",
+	42: "CGI Error",
+	43: "Proxy Error",
+	44: "Slow Down",
+	50: "Permanent Failure",
+	51: "Not Found",
+	52: "Gone",
+	53: "Proxy Request Refused",
+	59: "Bad Request",
+	60: "Client Certificate Required",
+	61: "Certificate Not Authorised",
+	62: "Certificate Not Valid",
+}
+
+// sha1FingerprintLength is the length of the fingerprints
+// stored by older versions, which used SHA-1
+const sha1FingerprintLength = 59
+
 var BlockBehavior string = "block"
 var TlsTimeout time.Duration = time.Duration(15) * time.Second
 
+// TlsMode is how server certificates are verified: "tofu"
+// pins the first certificate seen, "ca" requires one issued
+// by a trusted certificate authority, and "either" accepts a
+// certificate authority before falling back to tofu
+var TlsMode string = "tofu"
+
+// RootCAs are the certificate authorities trusted in the "ca"
+// and "either" modes, nil uses those of the system
+var RootCAs *x509.CertPool
+
 //------------------------------------------------\\
 // + + +          R E C E I V E R S          + + + \\
 //--------------------------------------------------\\
@@ -36,16 +109,101 @@ func (t *TofuDigest) Purge(host string) error {
 	host = strings.ToLower(host)
 	if host == "*" {
 		t.certs = make(map[string]string)
+		t.accepted = make(map[string]CertInfo)
 		return nil
 	} else if _, ok := t.certs[strings.ToLower(host)]; ok {
 		delete(t.certs, host)
+		delete(t.accepted, host)
 		return nil
 	}
 	return fmt.Errorf("Invalid host %q", host)
 }
 
-func (t *TofuDigest) Add(host, hash string, time int64) {
-	t.certs[strings.ToLower(host)] = fmt.Sprintf("%s|%d", hash, time)
+// Add trusts cert for host. The entry is stored in the form
+// "fingerprint|expiry|subject|last seen", times being unix
+// timestamps, as it is written to the config file.
+func (t *TofuDigest) Add(host string, cert CertInfo) {
+	// The subject is kept in the config file, which cannot hold
+	// these characters
+	subject := strings.NewReplacer("|", "", "[", "", "]", "", "=", "", "\n", "").Replace(cert.Subject)
+	lastSeen := int64(0)
+	if !cert.LastSeen.IsZero() {
+		lastSeen = cert.LastSeen.Unix()
+	}
+	t.certs[strings.ToLower(host)] = fmt.Sprintf("%s|%d|%s|%d", cert.Fingerprint, cert.Expires.Unix(), subject, lastSeen)
+}
+
+// Lookup returns the certificate that is trusted for host
+func (t *TofuDigest) Lookup(host string) (CertInfo, bool) {
+	entry, ok := t.certs[strings.ToLower(host)]
+	if !ok {
+		return CertInfo{}, false
+	}
+	info, _ := ParseCertEntry(entry)
+	return info, true
+}
+
+// Hosts returns the hosts that have a trusted certificate,
+// including those accepted for this session only, sorted
+func (t *TofuDigest) Hosts() []string {
+	hosts := make([]string, 0, len(t.certs))
+	for host := range t.certs {
+		hosts = append(hosts, host)
+	}
+	for host := range t.accepted {
+		if _, ok := t.certs[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Accept trusts cert for host in place of any certificate
+// that was trusted before
+func (t *TofuDigest) Accept(host string, cert CertInfo) {
+	delete(t.accepted, strings.ToLower(host))
+	if cert.LastSeen.IsZero() {
+		cert.LastSeen = time.Now()
+	}
+	t.Add(host, cert)
+}
+
+// AcceptOnce trusts cert for host until the client exits,
+// alongside the certificate that is already trusted
+func (t *TofuDigest) AcceptOnce(host string, cert CertInfo) {
+	t.accepted[strings.ToLower(host)] = cert
+}
+
+// Accepted returns the certificate accepted for host for
+// this session only, if there is one
+func (t *TofuDigest) Accepted(host string) (CertInfo, bool) {
+	cert, ok := t.accepted[strings.ToLower(host)]
+	return cert, ok
+}
+
+// Pin permanently trusts the certificate that was accepted
+// for host for this session only
+func (t *TofuDigest) Pin(host string) error {
+	cert, ok := t.Accepted(host)
+	if !ok {
+		return fmt.Errorf("No certificate has been accepted once for %q", strings.ToLower(host))
+	}
+	t.Accept(host, cert)
+	return nil
+}
+
+// Verification describes how the certificate of host was
+// verified when it was last visited
+func (t *TofuDigest) Verification(host string) string {
+	return t.verified[strings.ToLower(host)]
+}
+
+// Chain returns the certificate chain that host presented
+// when it was last visited
+func (t *TofuDigest) Chain(host string) ([]*x509.Certificate, bool) {
+	chain, ok := t.chains[strings.ToLower(host)]
+	return chain, ok
 }
 
 func (t *TofuDigest) Exists(host string) bool {
@@ -64,9 +222,17 @@ func (t *TofuDigest) Find(host string) (string, error) {
 
 func (t *TofuDigest) Match(host, localCert string, cState *tls.ConnectionState) error {
 	now := time.Now()
+	// Entries written by older versions hold a SHA-1
+	// fingerprint, which is replaced once it has matched
+	legacy := len(localCert) == sha1FingerprintLength
 
 	for _, cert := range cState.PeerCertificates {
-		if localCert != hashCert(cert.Raw) {
+		hash := hashCert(cert.Raw)
+		once, accepted := t.Accepted(host)
+		accepted = accepted && once.Fingerprint == hash
+		if legacy && localCert != hashCertSHA1(cert.Raw) && !accepted {
+			continue
+		} else if !legacy && localCert != hash && !accepted {
 			continue
 		}
 
@@ -78,45 +244,104 @@ func (t *TofuDigest) Match(host, localCert string, cState *tls.ConnectionState)
 			return fmt.Errorf("EXP")
 		}
 
-		if err := cert.VerifyHostname(host); err != nil && cert.Subject.CommonName != host {
+		if err := verifyHostname(cert, host); err != nil {
 			return fmt.Errorf("Certificate error: %s", err)
 		}
 
+		seen := certInfo(cert)
+		seen.LastSeen = now
+		if accepted {
+			t.AcceptOnce(host, seen)
+		} else {
+			// This also replaces the fingerprint of a legacy
+			// entry with its SHA-256 fingerprint
+			t.Add(host, seen)
+		}
+		t.chains[strings.ToLower(host)] = cState.PeerCertificates
 		return nil
 	}
 
-	return fmt.Errorf("No matching certificate was found for host %q", host)
+	// The host has a new certificate, if it is valid the user
+	// may choose to trust it
+	cert, err := validCert(host, cState)
+	if err != nil {
+		return err
+	}
+	old, _ := t.Lookup(host)
+	t.chains[strings.ToLower(host)] = cState.PeerCertificates
+	newSHA1 := ""
+	if legacy {
+		newSHA1 = hashCertSHA1(cert.Raw)
+	}
+	return &CertChangeError{strings.ToLower(host), old, certInfo(cert), newSHA1}
 }
 
-func (t *TofuDigest) newCert(host string, cState *tls.ConnectionState) error {
+// Screen verifies the certificate a host has presented,
+// according to TlsMode, and records how it was verified. It
+// is shared with other protocols that pin certificates in
+// the same way, such as gopher over TLS. Gemini pins are
+// keyed by host, other protocols key theirs by host and port
+// so that they are kept apart from gemini's.
+func (t *TofuDigest) Screen(host string, cState *tls.ConnectionState) error {
 	host = strings.ToLower(host)
-	now := time.Now()
-	var reasons strings.Builder
 
-	for index, cert := range cState.PeerCertificates {
-		if index > 0 {
-			reasons.WriteString("; ")
-		}
-		if now.Before(cert.NotBefore) {
-			reasons.WriteString(fmt.Sprintf("Cert [%d] is not valid yet", index+1))
-			continue
+	// Certificate authorities are checked first, and are all
+	// that is checked in "ca" mode
+	caNote := ""
+	if TlsMode == "ca" || TlsMode == "either" {
+		issuer, err := verifyCA(host, cState)
+		if err == nil {
+			t.chains[host] = cState.PeerCertificates
+			t.verified[host] = fmt.Sprintf("Verified by certificate authority %s", issuer)
+			return nil
+		} else if TlsMode == "ca" {
+			return fmt.Errorf("Certificate authority verification failed: %s", err.Error())
 		}
+		caNote = fmt.Sprintf(" (not verified by a certificate authority: %s)", err.Error())
+	}
 
-		if now.After(cert.NotAfter) {
-			reasons.WriteString(fmt.Sprintf("Cert [%d] is expired", index+1))
-			continue
-		}
+	// Begin TOFU screening...
+	result := "matches the pinned certificate"
+	localCert, localTs, err := t.GetCertAndTimestamp(host)
 
-		if err := cert.VerifyHostname(host); err != nil && cert.Subject.CommonName != host {
-			reasons.WriteString(fmt.Sprintf("Cert [%d] hostname does not match", index+1))
-			continue
+	if localTs > 0 {
+		// See if we have a matching cert
+		err := t.Match(host, localCert, cState)
+		if err != nil && err.Error() != "EXP" {
+			// If there is no match and it isnt because of an expiration
+			// just return the error
+			return err
+		} else if err != nil {
+			// The cert expired, see if they are offering one that is valid...
+			err := t.newCert(host, cState)
+			if err != nil {
+				// If there are no valid certs to offer, let the client know
+				return err
+			}
+			result = "pinned on first use, replacing an expired certificate"
 		}
-
-		t.Add(host, hashCert(cert.Raw), cert.NotAfter.Unix())
-		return nil
+	} else {
+		err = t.newCert(host, cState)
+		if err != nil {
+			// If there are no valid certs to offer, let the client know
+			return err
+		}
+		result = "pinned on first use"
 	}
+	t.verified[host] = "Trust on first use: " + result + caNote
+	return nil
+}
 
-	return fmt.Errorf(reasons.String())
+func (t *TofuDigest) newCert(host string, cState *tls.ConnectionState) error {
+	cert, err := validCert(host, cState)
+	if err != nil {
+		return err
+	}
+	seen := certInfo(cert)
+	seen.LastSeen = time.Now()
+	t.Add(host, seen)
+	t.chains[strings.ToLower(host)] = cState.PeerCertificates
+	return nil
 }
 
 func (t *TofuDigest) GetCertAndTimestamp(host string) (string, int64, error) {
@@ -146,6 +371,25 @@ func (t *TofuDigest) GetCertAndTimestamp(host string) (string, int64, error) {
 	return certTsSplit[0], ts, nil
 }
 
+// Copy returns a TofuDigest holding the same certificates,
+// for use where the original cannot be shared
+func (t *TofuDigest) Copy() TofuDigest {
+	td := MakeTofuDigest()
+	for k, v := range t.certs {
+		td.certs[k] = v
+	}
+	for k, v := range t.accepted {
+		td.accepted[k] = v
+	}
+	for k, v := range t.chains {
+		td.chains[k] = v
+	}
+	for k, v := range t.verified {
+		td.verified[k] = v
+	}
+	return td
+}
+
 func (t *TofuDigest) IniDump() string {
 	if len(t.certs) < 1 {
 		return ""
@@ -165,160 +409,184 @@ func (t *TofuDigest) IniDump() string {
 // + + +          F U N C T I O N S          + + + \\
 //--------------------------------------------------\\
 
-func Retrieve(host, port, resource string, td *TofuDigest) (string, error) {
-	if host == "" || port == "" {
-		return "", fmt.Errorf("Incomplete request url")
+func Retrieve(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore) (string, error) {
+	conn, err := request(ctx, host, port, resource, td, ids)
+	if err != nil {
+		return "", err
 	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	addr := host + ":" + port
-
-	conf := &tls.Config{
-		MinVersion:         tls.VersionTLS12,
-		InsecureSkipVerify: true,
+	result, err := stream.ReadAll(ctx, conn)
+	if err != nil {
+		return "", err
 	}
 
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: TlsTimeout}, "tcp", addr, conf)
+	return string(result), nil
+}
+
+// Download makes a request and, if the response is successful,
+// writes the body to w as it is received rather than holding it
+// in memory
+func Download(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore, w io.Writer) error {
+	conn, err := request(ctx, host, port, resource, td, ids)
 	if err != nil {
-		return "", fmt.Errorf("TLS Dial Error: %s", err.Error())
+		return err
 	}
-
 	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	connState := conn.ConnectionState()
-
-	// Begin TOFU screening...
-
-	// If no certificates are offered, bail out
-	if len(connState.PeerCertificates) < 1 {
-		return "", fmt.Errorf("Insecure, no certificates offered by server")
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Invalid response from server")
 	}
 
-	localCert, localTs, err := td.GetCertAndTimestamp(host)
+	status, meta, _, err := parseResponse(header)
+	if err != nil {
+		return err
+	}
 
-	if localTs > 0 {
-		// See if we have a matching cert
-		err := td.Match(host, localCert, &connState)
-		if err != nil && err.Error() != "EXP" {
-			// If there is no match and it isnt because of an expiration
-			// just return the error
-			return "", err
-		} else if err != nil {
-			// The cert expired, see if they are offering one that is valid...
-			err := td.newCert(host, &connState)
-			if err != nil {
-				// If there are no valid certs to offer, let the client know
-				return "", err
-			}
-		}
-	} else {
-		err = td.newCert(host, &connState)
-		if err != nil {
-			// If there are no valid certs to offer, let the client know
-			return "", err
+	switch status / 10 {
+	case 1:
+		return fmt.Errorf("[%d] Queries cannot be saved.", status)
+	case 2:
+		_, err = stream.Copy(ctx, w, reader)
+		return err
+	case 3:
+		return fmt.Errorf("[%d] Redirects cannot be saved.", status)
+	case 6:
+		if status == 60 {
+			return fmt.Errorf("[60] Client Certificate Required. Visit the url to choose an identity.")
 		}
+		return errors.New(StatusMessage(status, meta))
+	default:
+		return errors.New(StatusMessage(status, meta))
 	}
+}
 
-	send := "gemini://" + addr + "/" + resource + "\r\n"
+// Status requests a resource and returns the status and meta
+// of the response header, the body is not read
+func Status(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore) (int, string, error) {
+	conn, err := request(ctx, host, port, resource, td, ids)
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	_, err = conn.Write([]byte(send))
+	header, err := bufio.NewReader(conn).ReadString('\n')
 	if err != nil {
-		return "", err
+		return 0, "", fmt.Errorf("Invalid response from server")
 	}
+	status, meta, _, err := parseResponse(header)
+	return status, meta, err
+}
 
-	result, err := ioutil.ReadAll(conn)
+// request connects to a capsule, screens its certificate,
+// and sends the request for resource
+func request(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore) (*tls.Conn, error) {
+	conn, err := Dial(ctx, host, port, resource, td, ids)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(result), nil
-}
+	send := "gemini://" + net.JoinHostPort(host, port) + "/" + resource + "\r\n"
 
-func Fetch(host, port, resource string, td *TofuDigest) ([]byte, error) {
-	rawResp, err := Retrieve(host, port, resource, td)
+	_, err = conn.Write([]byte(send))
 	if err != nil {
-		return make([]byte, 0), err
+		conn.Close()
+		return nil, err
 	}
 
-	resp := strings.SplitN(rawResp, "\r\n", 2)
-	if len(resp) != 2 {
-		if err != nil {
-			return make([]byte, 0), fmt.Errorf("Invalid response from server")
-		}
+	return conn, nil
+}
+
+// Dial connects to a capsule and screens its certificate,
+// presenting the client certificate assigned to resource if
+// there is one. It is shared with protocols that use the same
+// TLS and trust rules as gemini, such as titan.
+func Dial(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore) (*tls.Conn, error) {
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Incomplete request url")
 	}
-	header := strings.SplitN(resp[0], " ", 2)
-	if len([]rune(header[0])) != 2 {
-		header = strings.SplitN(resp[0], "\t", 2)
-		if len([]rune(header[0])) != 2 {
-			return make([]byte, 0), fmt.Errorf("Invalid response format from server")
-		}
+
+	addr := net.JoinHostPort(host, port)
+
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
 	}
 
-	// Get status code single digit form
-	status, err := strconv.Atoi(string(header[0][0]))
-	if err != nil {
-		return make([]byte, 0), fmt.Errorf("Invalid status response from server")
-	}
-
-	if status != 2 {
-		switch status {
-		case 1:
-			return make([]byte, 0), fmt.Errorf("[1] Queries cannot be saved.")
-		case 3:
-			return make([]byte, 0), fmt.Errorf("[3] Redirects cannot be saved.")
-		case 4:
-			return make([]byte, 0), fmt.Errorf("[4] Temporary Failure.")
-		case 5:
-			return make([]byte, 0), fmt.Errorf("[5] Permanent Failure.")
-		case 6:
-			return make([]byte, 0), fmt.Errorf("[6] Client Certificate Required (Unsupported)")
-		default:
-			return make([]byte, 0), fmt.Errorf("Invalid response status from server")
+	// Present a client certificate if one has been assigned
+	// to this part of the capsule
+	if cert, ok := ids.Find(host, resource); ok {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
 		}
 	}
 
-	return []byte(resp[1]), nil
-
-}
-
-func Visit(host, port, resource string, td *TofuDigest) (Capsule, error) {
-	capsule := MakeCapsule()
-	rawResp, err := Retrieve(host, port, resource, td)
+	dialer := net.Dialer{Timeout: TlsTimeout}
+	rawConn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return capsule, err
+		return nil, fmt.Errorf("TLS Dial Error: %s", err.Error())
+	}
+	conn := tls.Client(rawConn, conf)
+	_ = conn.SetDeadline(time.Now().Add(TlsTimeout))
+	stopWatching := stream.CloseOnCancel(ctx, conn)
+	err = conn.Handshake()
+	stopWatching()
+	_ = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS Dial Error: %s", err.Error())
 	}
 
-	resp := strings.SplitN(rawResp, "\r\n", 2)
-	if len(resp) != 2 {
-		if err != nil {
-			return capsule, fmt.Errorf("Invalid response from server")
-		}
+	connState := conn.ConnectionState()
+
+	// If no certificates are offered, bail out
+	if len(connState.PeerCertificates) < 1 {
+		conn.Close()
+		return nil, fmt.Errorf("Insecure, no certificates offered by server")
 	}
-	header := strings.SplitN(resp[0], " ", 2)
-	if len([]rune(header[0])) != 2 {
-		header = strings.SplitN(resp[0], "\t", 2)
-		if len([]rune(header[0])) != 2 {
-			return capsule, fmt.Errorf("Invalid response format from server")
-		}
+
+	err = td.Screen(host, &connState)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	body := resp[1]
+	return conn, nil
+}
 
-	// Get status code single digit form
-	capsule.Status, err = strconv.Atoi(string(header[0][0]))
+func Visit(ctx context.Context, host, port, resource string, td *TofuDigest, ids *IdentityStore) (Capsule, error) {
+	rawResp, err := Retrieve(ctx, host, port, resource, td, ids)
 	if err != nil {
-		return capsule, fmt.Errorf("Invalid status response from server")
+		return MakeCapsule(), err
 	}
+	return ParseCapsule(rawResp, host, port, resource)
+}
 
-	// Parse the meta as needed
-	var meta string
+// ParseCapsule builds a Capsule from a raw response to a
+// request for resource from host and port
+func ParseCapsule(rawResp, host, port, resource string) (Capsule, error) {
+	capsule := MakeCapsule()
+	var meta, body string
+	var err error
+	capsule.Status, meta, body, err = parseResponse(rawResp)
+	if err != nil {
+		return capsule, err
+	}
 
 	switch capsule.Status {
-	case 1:
-		capsule.Content = header[1]
+	case 10, 11:
+		// The client will prompt for input, hiding it
+		// for sensitive (11) input
+		capsule.Content = meta
 		return capsule, nil
-	case 2:
-		mimeAndCharset := strings.Split(header[1], ";")
-		meta = mimeAndCharset[0]
+	case 20:
+		mimeAndCharset := strings.Split(meta, ";")
+		meta = strings.TrimSpace(mimeAndCharset[0])
 		if meta == "" {
 			meta = "text/gemini"
 		}
@@ -334,29 +602,74 @@ func Visit(host, port, resource string, td *TofuDigest) (Capsule, error) {
 			} else if resource == "" {
 				resource = "/"
 			}
-			currentUrl := fmt.Sprintf("gemini://%s:%s%s", host, port, resource)
-			capsule.Content, capsule.Links = parseGemini(body, currentUrl)
+			currentUrl := fmt.Sprintf("gemini://%s%s", net.JoinHostPort(host, port), resource)
+			capsule.Content, capsule.Links = ParseGemtext(body, currentUrl, false)
 		} else {
 			capsule.Content = body
 		}
 		return capsule, nil
-	case 3:
-		// The client will handle informing the user of a redirect
-		// and then request the new url
-		capsule.Content = header[1]
+	case 30, 31, 44, 60:
+		// The client will handle informing the user of a
+		// redirect, a requested wait, or a certificate request
+		// and then act on the meta as needed
+		capsule.Content = meta
 		return capsule, nil
-	case 4:
-		return capsule, fmt.Errorf("[4] Temporary Failure. %s", header[1])
-	case 5:
-		return capsule, fmt.Errorf("[5] Permanent Failure. %s", header[1])
-	case 6:
-		return capsule, fmt.Errorf("[6] Client Certificate Required (Unsupported)")
 	default:
-		return capsule, fmt.Errorf("Invalid response status from server")
+		return capsule, errors.New(StatusMessage(capsule.Status, meta))
+	}
+}
+
+// StatusMessage returns a human readable description of a
+// two digit status code, including the meta sent by the server
+func StatusMessage(status int, meta string) string {
+	msg, ok := statusMessages[status]
+	if !ok {
+		msg = "Invalid response status from server"
+	}
+	if meta != "" {
+		return fmt.Sprintf("[%d] %s: %s", status, msg, meta)
+	}
+	return fmt.Sprintf("[%d] %s", status, msg)
+}
+
+// parseResponse splits a raw response into its two digit status,
+// meta, and body. Unknown codes are treated as the base code for
+// their class, as the specification requires
+func parseResponse(rawResp string) (int, string, string, error) {
+	resp := strings.SplitN(rawResp, "\r\n", 2)
+	if len(resp) != 2 {
+		return 0, "", "", fmt.Errorf("Invalid response from server")
 	}
+	header := strings.SplitN(resp[0], " ", 2)
+	if len([]rune(header[0])) != 2 {
+		header = strings.SplitN(resp[0], "\t", 2)
+		if len([]rune(header[0])) != 2 {
+			return 0, "", "", fmt.Errorf("Invalid response format from server")
+		}
+	}
+
+	status, err := strconv.Atoi(header[0])
+	if err != nil || status < 10 || status > 69 {
+		return 0, "", "", fmt.Errorf("Invalid status response from server")
+	}
+	if _, ok := statusMessages[status]; !ok {
+		status = status / 10 * 10
+	}
+
+	var meta string
+	if len(header) > 1 {
+		meta = strings.TrimSpace(header[1])
+	}
+
+	return status, meta, resp[1], nil
 }
 
-func parseGemini(b, currentUrl string) (string, []string) {
+// ParseGemtext renders a text/gemini document, returning its
+// content and links. currentUrl is used to resolve relative
+// links. If inputLinks is true, as it is for spartan, '=:'
+// lines are also links: they end with an empty query, which
+// tells the client to prompt for input before visiting them.
+func ParseGemtext(b, currentUrl string, inputLinks bool) (string, []string) {
 	splitContent := strings.Split(b, "\n")
 	links := make([]string, 0, 10)
 
@@ -377,7 +690,7 @@ func parseGemini(b, currentUrl string) (string, []string) {
 			}
 		} else if isPreBlockDeclaration {
 			inPreBlock = !inPreBlock
-		} else if len([]rune(ln)) > 3 && ln[:2] == "=>" && !inPreBlock {
+		} else if len([]rune(ln)) > 3 && (ln[:2] == "=>" || (inputLinks && ln[:2] == "=:")) && !inPreBlock {
 			var link, decorator string
 			subLn := strings.Trim(ln[2:], "\r\n\t \a")
 			splitPoint := strings.IndexAny(subLn, " \t")
@@ -394,6 +707,14 @@ func parseGemini(b, currentUrl string) (string, []string) {
 				link, _ = HandleRelativeUrl(link, currentUrl)
 			}
 
+			if ln[:2] == "=:" {
+				if ind := strings.Index(link, "?"); ind >= 0 {
+					link = link[:ind]
+				}
+				link += "?"
+				decorator += " (input)"
+			}
+
 			links = append(links, link)
 			linknum := fmt.Sprintf("[%d]", len(links))
 			splitContent[outputIndex] = fmt.Sprintf("%-5s %s", linknum, decorator)
@@ -427,8 +748,166 @@ func HandleRelativeUrl(relLink, current string) (string, error) {
 	return base.ResolveReference(rel).String(), nil
 }
 
+func (e *CertChangeError) Error() string {
+	return fmt.Sprintf("The certificate for host %q has changed", e.Host)
+}
+
+// verifyCA verifies the certificate chain of a connection
+// against RootCAs, returning the name of the issuer of the
+// server's certificate
+func verifyCA(host string, cState *tls.ConnectionState) (string, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range cState.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := cState.PeerCertificates[0]
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       hostName(host),
+		Roots:         RootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return "", err
+	}
+	issuer := leaf.Issuer.CommonName
+	if issuer == "" {
+		issuer = leaf.Issuer.String()
+	}
+	return issuer, nil
+}
+
+// LoadCABundle sets RootCAs to the certificate authorities of
+// the system along with those in the PEM file at path. An
+// empty path uses the system's certificate authorities alone.
+func LoadCABundle(path string) error {
+	if path == "" {
+		RootCAs = nil
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("No certificates were found in %q", path)
+	}
+	RootCAs = pool
+	return nil
+}
+
+// validCert returns the first certificate offered for host
+// that is currently valid and matches the hostname
+func validCert(host string, cState *tls.ConnectionState) (*x509.Certificate, error) {
+	host = strings.ToLower(host)
+	now := time.Now()
+	var reasons strings.Builder
+
+	for index, cert := range cState.PeerCertificates {
+		if index > 0 {
+			reasons.WriteString("; ")
+		}
+		if now.Before(cert.NotBefore) {
+			reasons.WriteString(fmt.Sprintf("Cert [%d] is not valid yet", index+1))
+			continue
+		}
+
+		if now.After(cert.NotAfter) {
+			reasons.WriteString(fmt.Sprintf("Cert [%d] is expired", index+1))
+			continue
+		}
+
+		if err := verifyHostname(cert, host); err != nil {
+			reasons.WriteString(fmt.Sprintf("Cert [%d] hostname does not match", index+1))
+			continue
+		}
+
+		return cert, nil
+	}
+
+	return nil, errors.New(reasons.String())
+}
+
+// verifyHostname checks that cert is for the host a pin is
+// keyed by, allowing for a common name that is not a hostname
+func verifyHostname(cert *x509.Certificate, key string) error {
+	host := hostName(key)
+	err := cert.VerifyHostname(host)
+	if err != nil && cert.Subject.CommonName != host {
+		return err
+	}
+	return nil
+}
+
+// hostName returns the host of a key that also has a port
+func hostName(key string) string {
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		return host
+	}
+	return key
+}
+
+func certInfo(cert *x509.Certificate) CertInfo {
+	return CertInfo{hashCert(cert.Raw), certSubject(cert), cert.NotAfter, time.Time{}}
+}
+
+// ParseCertEntry reads a certificate entry in the form that
+// TofuDigest stores it. The subject and last seen time are
+// missing from entries written by older versions.
+func ParseCertEntry(entry string) (CertInfo, error) {
+	fields := strings.Split(entry, "|")
+	info := CertInfo{Fingerprint: fields[0]}
+	if len(fields) < 2 {
+		return info, fmt.Errorf("Invalid certstring, no delimiter")
+	}
+	ts, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return info, err
+	}
+	info.Expires = time.Unix(ts, 0)
+	if len(fields) > 2 {
+		info.Subject = fields[2]
+	}
+	if len(fields) > 3 {
+		if seen, err := strconv.ParseInt(fields[3], 10, 64); err == nil && seen > 0 {
+			info.LastSeen = time.Unix(seen, 0)
+		}
+	}
+	return info, nil
+}
+
+func certSubject(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	} else if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// Fingerprint returns the SHA-256 fingerprint of cert, in
+// the form that is pinned
+func Fingerprint(cert *x509.Certificate) string {
+	return hashCert(cert.Raw)
+}
+
+// hashCert returns the SHA-256 fingerprint of a certificate
 func hashCert(cert []byte) string {
+	hash := sha256.Sum256(cert)
+	return fingerprint(hash[:])
+}
+
+// hashCertSHA1 returns a fingerprint in the form used by
+// older versions, so that their entries can be migrated
+func hashCertSHA1(cert []byte) string {
 	hash := sha1.Sum(cert)
+	return fingerprint(hash[:])
+}
+
+func fingerprint(hash []byte) string {
 	hex := make([][]byte, len(hash))
 	for i, data := range hash {
 		hex[i] = []byte(fmt.Sprintf("%02X", data))
@@ -441,5 +920,5 @@ func MakeCapsule() Capsule {
 }
 
 func MakeTofuDigest() TofuDigest {
-	return TofuDigest{make(map[string]string)}
+	return TofuDigest{make(map[string]string), make(map[string]CertInfo), make(map[string][]*x509.Certificate), make(map[string]string)}
 }
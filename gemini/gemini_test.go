@@ -0,0 +1,122 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_TofuDigest_Match(t *testing.T) {
+	host := "example.org"
+	// The host presents one certificate, the pin is either for
+	// it or for another, in the current or the older form
+	presented := testCert(t, host)
+	other := testCert(t, host)
+
+	tests := []struct {
+		name     string
+		pin      string
+		once     bool
+		expects  string
+		pinAfter string
+	}{
+		{
+			"Pinned certificate matches",
+			hashCert(presented.Raw),
+			false,
+			"",
+			hashCert(presented.Raw),
+		},
+		{
+			"Older SHA-1 pin matches and is replaced",
+			hashCertSHA1(presented.Raw),
+			false,
+			"",
+			hashCert(presented.Raw),
+		},
+		{
+			"Changed certificate accepted once",
+			hashCert(other.Raw),
+			true,
+			"",
+			hashCert(other.Raw),
+		},
+		{
+			"Changed certificate accepted once over an older SHA-1 pin",
+			hashCertSHA1(other.Raw),
+			true,
+			"",
+			hashCertSHA1(other.Raw),
+		},
+		{
+			"Changed certificate",
+			hashCert(other.Raw),
+			false,
+			"changed",
+			hashCert(other.Raw),
+		},
+		{
+			"Changed certificate over an older SHA-1 pin",
+			hashCertSHA1(other.Raw),
+			false,
+			"changed " + hashCertSHA1(presented.Raw),
+			hashCertSHA1(other.Raw),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := MakeTofuDigest()
+			expires := time.Now().Add(time.Hour).Unix()
+			td.certs[host] = fmt.Sprintf("%s|%d", tt.pin, expires)
+			if tt.once {
+				td.AcceptOnce(host, certInfo(presented))
+			}
+			state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{presented}}
+
+			actual := ""
+			err := td.Match(host, tt.pin, state)
+			if changed, ok := err.(*CertChangeError); ok {
+				actual = strings.TrimSpace("changed " + changed.NewSHA1)
+			} else if err != nil {
+				actual = err.Error()
+			}
+			pin, _ := td.Find(host)
+			pin = strings.SplitN(pin, "|", 2)[0]
+			if actual != tt.expects || pin != tt.pinAfter {
+				t.Errorf("Test failed - %s\nexpects %q, pin %s\nactual  %q, pin %s", tt.name, tt.expects, tt.pinAfter, actual, pin)
+			}
+		})
+	}
+}
+
+// testCert returns a new self-signed certificate for host
+func testCert(t *testing.T, host string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -0,0 +1,299 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Identity is a named, self-signed client certificate that
+// can be presented to capsules that request one
+type Identity struct {
+	Name    string
+	Expires time.Time
+	cert    tls.Certificate
+}
+
+// IdentityStore holds the client identities available to the
+// user, along with the scopes (host and path prefixes) that
+// each identity is presented to
+type IdentityStore struct {
+	dir        string
+	identities map[string]Identity
+	scopes     map[string]string
+}
+
+var validIdentityName = regexp.MustCompile(`^[\w\-\.]+$`)
+
+//------------------------------------------------\\
+// + + +          R E C E I V E R S          + + + \\
+//--------------------------------------------------\\
+
+// Load reads all of the identities stored in dir. The directory
+// is also where newly created identities will be written. Files
+// that cannot be read are skipped and named in the error.
+func (s *IdentityStore) Load(dir string) error {
+	s.dir = dir
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	var bad []string
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".pem")
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			bad = append(bad, name)
+			continue
+		}
+		id, err := parseIdentity(name, data)
+		if err != nil {
+			bad = append(bad, name)
+			continue
+		}
+		s.identities[name] = id
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("Could not load identities: %s", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// Create generates a new self-signed identity valid for the given
+// number of days and writes it to the identity directory
+func (s *IdentityStore) Create(name string, days int) (Identity, error) {
+	if !validIdentityName.MatchString(name) {
+		return Identity{}, fmt.Errorf("Invalid identity name %q, use letters, numbers, '-', '_' or '.'", name)
+	}
+	if _, ok := s.identities[name]; ok {
+		return Identity{}, fmt.Errorf("An identity named %q already exists", name)
+	}
+	if days < 1 {
+		return Identity{}, fmt.Errorf("An identity must be valid for at least one day")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Identity{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return Identity{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(0, 0, days),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return Identity{}, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var data []byte
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+
+	err = os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return Identity{}, err
+	}
+	err = ioutil.WriteFile(s.path(name), data, 0600)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	id, err := parseIdentity(name, data)
+	if err != nil {
+		return Identity{}, err
+	}
+	s.identities[name] = id
+	return id, nil
+}
+
+// Rename changes the name of an identity, keeping its scopes
+func (s *IdentityStore) Rename(oldName, newName string) error {
+	id, ok := s.identities[oldName]
+	if !ok {
+		return fmt.Errorf("There is no identity named %q", oldName)
+	}
+	if !validIdentityName.MatchString(newName) {
+		return fmt.Errorf("Invalid identity name %q, use letters, numbers, '-', '_' or '.'", newName)
+	}
+	if _, ok := s.identities[newName]; ok {
+		return fmt.Errorf("An identity named %q already exists", newName)
+	}
+	err := os.Rename(s.path(oldName), s.path(newName))
+	if err != nil {
+		return err
+	}
+	id.Name = newName
+	delete(s.identities, oldName)
+	s.identities[newName] = id
+	for scope, name := range s.scopes {
+		if name == oldName {
+			s.scopes[scope] = newName
+		}
+	}
+	return nil
+}
+
+// Delete removes an identity and any scopes it was assigned to
+func (s *IdentityStore) Delete(name string) error {
+	if _, ok := s.identities[name]; !ok {
+		return fmt.Errorf("There is no identity named %q", name)
+	}
+	err := os.Remove(s.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.identities, name)
+	for scope, n := range s.scopes {
+		if n == name {
+			delete(s.scopes, scope)
+		}
+	}
+	return nil
+}
+
+// Export writes the certificate and private key of an identity
+// to the given path in PEM format
+func (s *IdentityStore) Export(name, path string) error {
+	if _, ok := s.identities[name]; !ok {
+		return fmt.Errorf("There is no identity named %q", name)
+	}
+	data, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Assign sets the identity to use for a scope, as built by Scope.
+// Only the host is case folded, paths are case sensitive.
+func (s *IdentityStore) Assign(scope, name string) error {
+	if _, ok := s.identities[name]; !ok {
+		return fmt.Errorf("There is no identity named %q", name)
+	}
+	host, resource := scope, ""
+	if i := strings.Index(scope, "/"); i >= 0 {
+		host, resource = scope[:i], scope[i:]
+	}
+	s.scopes[strings.ToLower(host)+resource] = name
+	return nil
+}
+
+// Get returns the identity with the given name
+func (s *IdentityStore) Get(name string) (Identity, bool) {
+	id, ok := s.identities[name]
+	return id, ok
+}
+
+// Names returns a sorted list of the available identities
+func (s *IdentityStore) Names() []string {
+	out := make([]string, 0, len(s.identities))
+	for name := range s.identities {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Find returns the certificate for the identity whose scope most
+// closely matches the host and resource being requested
+func (s *IdentityStore) Find(host, resource string) (*tls.Certificate, bool) {
+	if s == nil {
+		return nil, false
+	}
+	target := Scope(host, resource)
+	best := ""
+	for scope := range s.scopes {
+		if len(scope) <= len(best) || !strings.HasPrefix(target, scope) {
+			continue
+		}
+		if len(target) == len(scope) || strings.HasSuffix(scope, "/") || target[len(scope)] == '/' {
+			best = scope
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	id, ok := s.identities[s.scopes[best]]
+	if !ok {
+		return nil, false
+	}
+	return &id.cert, true
+}
+
+// IniDump returns a string representing the identity scopes
+// in the format that .bombadillo.ini uses
+func (s *IdentityStore) IniDump() string {
+	if len(s.scopes) < 1 {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString("[IDENTITIES]\n")
+	for k, v := range s.scopes {
+		out.WriteString(k)
+		out.WriteString("=")
+		out.WriteString(v)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+func (s *IdentityStore) path(name string) string {
+	return filepath.Join(s.dir, name+".pem")
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// Scope builds the key an identity is assigned to for a given
+// host and resource: the host followed by the resource path
+func Scope(host, resource string) string {
+	if i := strings.IndexAny(resource, "?#"); i >= 0 {
+		resource = resource[:i]
+	}
+	resource = strings.TrimPrefix(resource, "/")
+	return strings.ToLower(host) + "/" + resource
+}
+
+func parseIdentity(name string, data []byte) (Identity, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return Identity{}, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{name, leaf.NotAfter, cert}, nil
+}
+
+func MakeIdentityStore() IdentityStore {
+	return IdentityStore{"", make(map[string]Identity), make(map[string]string)}
+}
@@ -0,0 +1,58 @@
+package gemini
+
+import (
+	"testing"
+)
+
+func Test_IdentityStore_Assign_Find(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    string
+		host     string
+		resource string
+		expects  bool
+	}{
+		{
+			"Host case is ignored",
+			"Example.ORG/",
+			"example.org",
+			"/",
+			true,
+		},
+		{
+			"Path case is kept",
+			"example.org/Private",
+			"EXAMPLE.org",
+			"/Private/page.gmi",
+			true,
+		},
+		{
+			"Path of a different case does not match",
+			"example.org/Private",
+			"example.org",
+			"/private/page.gmi",
+			false,
+		},
+		{
+			"Path that only shares a prefix does not match",
+			"example.org/priv",
+			"example.org",
+			"/private",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MakeIdentityStore()
+			s.identities["me"] = Identity{Name: "me"}
+			err := s.Assign(tt.scope, "me")
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s", tt.name, err)
+			}
+			_, found := s.Find(tt.host, tt.resource)
+			if found != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %t\nactual  %t", tt.name, tt.expects, found)
+			}
+		})
+	}
+}
@@ -4,12 +4,20 @@
 package gopher
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"strings"
+	"sync"
 	"time"
+
+	"tildegit.org/sloum/bombadillo/gemini"
+	"tildegit.org/sloum/bombadillo/stream"
 )
 
 //------------------------------------------------\\
@@ -21,6 +29,7 @@ import (
 var types = map[string]string{
 	"0": "TXT",
 	"1": "MAP",
+	"2": "CSO",
 	"3": "ERR",
 	"4": "BIN",
 	"5": "DOS",
@@ -40,6 +49,20 @@ var types = map[string]string{
 
 var Timeout time.Duration = time.Duration(15) * time.Second
 
+// OpportunisticTLS, when true, tries TLS first for plain gopher
+// urls, falling back to plain text for servers that do not
+// offer it
+var OpportunisticTLS bool = false
+
+// probeTimeout is the longest a TLS handshake may take when
+// finding out whether a server offers TLS
+var probeTimeout time.Duration = time.Duration(5) * time.Second
+
+// tlsHosts records, for each address tried, whether the server
+// offered TLS, so that it is only probed once per session
+var tlsHosts = map[string]bool{}
+var tlsHostsLock sync.Mutex
+
 //------------------------------------------------\\
 // + + +          F U N C T I O N S          + + + \\
 //--------------------------------------------------\\
@@ -49,55 +72,200 @@ var Timeout time.Duration = time.Duration(15) * time.Second
 // available to use directly, but in most implementations
 // using the "Visit" receiver of the History struct will
 // be better.
-func Retrieve(host, port, resource string) ([]byte, error) {
+func Retrieve(ctx context.Context, host, port, resource string, secure bool, td *gemini.TofuDigest) ([]byte, error) {
 	nullRes := make([]byte, 0)
 
-	if host == "" || port == "" {
-		return nullRes, errors.New("Incomplete request url")
+	conn, err := request(ctx, host, port, resource, secure, td)
+	if err != nil {
+		return nullRes, err
 	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	addr := host + ":" + port
-
-	conn, err := net.DialTimeout("tcp", addr, Timeout)
+	result, err := stream.ReadAll(ctx, conn)
 	if err != nil {
 		return nullRes, err
 	}
 
-	send := resource + "\n"
+	// Gopher+ responses start with a header giving their length
+	if _, _, plus := SplitRequest(resource); plus != "" {
+		return decodePlus(result)
+	}
 
-	_, err = conn.Write([]byte(send))
+	return result, nil
+}
+
+// Check requests a resource and reports whether the server
+// answered with anything. An error item at the top of a menu
+// is returned as an error.
+func Check(ctx context.Context, gophertype, host, port, resource string, secure bool, td *gemini.TofuDigest) error {
+	conn, err := request(ctx, host, port, resource, secure, td)
 	if err != nil {
-		return nullRes, err
+		return err
 	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	result, err := ioutil.ReadAll(conn)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if line == "" && err != nil {
+		return fmt.Errorf("No response from server")
+	}
+	if IsErrorMenu(gophertype, []byte(line)) {
+		return fmt.Errorf("%s", strings.SplitN(line[1:], "\t", 2)[0])
+	}
+	return nil
+}
+
+// IsErrorMenu reports whether resp is a menu that starts
+// with an error item, as servers send for a missing selector
+func IsErrorMenu(gophertype string, resp []byte) bool {
+	return (gophertype == "1" || gophertype == "7") && bytes.HasPrefix(resp, []byte("3"))
+}
+
+// Download makes a request to a Url and writes the
+// response to w as it is received, rather than holding
+// it in memory
+func Download(ctx context.Context, host, port, resource string, secure bool, td *gemini.TofuDigest, w io.Writer) error {
+	conn, err := request(ctx, host, port, resource, secure, td)
 	if err != nil {
-		return nullRes, err
+		return err
 	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
 
-	return result, nil
+	if _, _, plus := SplitRequest(resource); plus != "" {
+		return copyPlus(ctx, w, conn)
+	}
+	_, err = stream.Copy(ctx, w, conn)
+	return err
+}
+
+// Encrypted reports whether requests to a plain gopher url
+// at host and port are made over TLS
+func Encrypted(host, port string) bool {
+	tlsHostsLock.Lock()
+	defer tlsHostsLock.Unlock()
+	return tlsHosts[net.JoinHostPort(host, port)]
+}
+
+// request connects to host and sends the selector. Secure
+// connections (gophers urls) must use TLS, other connections
+// try it first if OpportunisticTLS is set. The certificates
+// of servers are screened by td, as they are for gemini.
+func request(ctx context.Context, host, port, resource string, secure bool, td *gemini.TofuDigest) (net.Conn, error) {
+	if host == "" || port == "" {
+		return nil, errors.New("Incomplete request url")
+	}
+
+	addr := net.JoinHostPort(host, port)
+
+	var conn net.Conn
+	var err error
+	tlsHostsLock.Lock()
+	offered, probed := tlsHosts[addr]
+	tlsHostsLock.Unlock()
+	if secure || (OpportunisticTLS && (offered || !probed)) {
+		timeout := Timeout
+		if !secure {
+			timeout = probeTimeout
+		}
+		// Once a server has offered TLS, falling back to plain
+		// text would allow the connection to be downgraded
+		conn, err = dialTLS(ctx, addr, timeout)
+		if err != nil && (secure || offered) {
+			return nil, fmt.Errorf("TLS Dial Error: %s", err.Error())
+		} else if err == nil {
+			cState := conn.(*tls.Conn).ConnectionState()
+			err = td.Screen(addr, &cState)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		if !secure {
+			tlsHostsLock.Lock()
+			tlsHosts[addr] = err == nil
+			tlsHostsLock.Unlock()
+		}
+	}
+
+	if conn == nil {
+		dialer := net.Dialer{Timeout: Timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	send := requestLine(resource)
+
+	_, err = conn.Write([]byte(send))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// dialTLS connects to addr and completes a TLS handshake
+// within timeout. The certificate is not verified here, that
+// is left to the TofuDigest.
+func dialTLS(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: Timeout}
+	rawConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+	})
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	stopWatching := stream.CloseOnCancel(ctx, conn)
+	err = conn.Handshake()
+	stopWatching()
+	_ = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if len(conn.ConnectionState().PeerCertificates) < 1 {
+		conn.Close()
+		return nil, fmt.Errorf("Insecure, no certificates offered by server")
+	}
+	return conn, nil
 }
 
 // Visit handles the making of the request, parsing of maps, and returning
 // the correct information to the client
-func Visit(gophertype, host, port, resource string) (string, []string, error) {
-	resp, err := Retrieve(host, port, resource)
+func Visit(ctx context.Context, gophertype, host, port, resource string, secure bool, td *gemini.TofuDigest) (string, []string, error) {
+	resp, err := Retrieve(ctx, host, port, resource, secure, td)
 	if err != nil {
 		return "", []string{}, err
 	}
 
+	text, links := Parse(gophertype, resp, host, port, secure)
+	return text, links, nil
+}
+
+// Parse turns a response of the given gophertype into text for
+// display, parsing gophermaps for their links. The host and port
+// it came from, and whether it was a gophers url, are used to
+// build links to the same server.
+func Parse(gophertype string, resp []byte, host, port string, secure bool) (string, []string) {
 	text := string(resp)
 	links := []string{}
 
 	if IsDownloadOnly(gophertype) {
-		return text, []string{}, nil
+		return text, []string{}
 	}
 
 	if gophertype == "1" {
-		text, links = parseMap(text)
+		text, links = parseMap(text, host, port, secure)
 	}
 
-	return text, links, nil
+	return text, links
 }
 
 func getType(t string) string {
@@ -116,7 +284,9 @@ func isWebLink(resource string) (string, bool) {
 	return "", false
 }
 
-func parseMap(text string) (string, []string) {
+// parseMap renders a gophermap from host and port. Items on
+// the same server as a secure menu are linked over TLS too.
+func parseMap(text, host, port string, secure bool) (string, []string) {
 	splitContent := strings.Split(text, "\n")
 	links := make([]string, 0, 10)
 
@@ -142,10 +312,19 @@ func parseMap(text string) (string, []string) {
 		if len(line) < 4 || strings.HasPrefix(line[0], "i") {
 			splitContent[i] = "           " + string(title)
 		} else {
-			link := buildLink(line[2], line[3], string(line[0][0]), line[1])
+			scheme := "gopher"
+			if secure && strings.EqualFold(line[2], host) && line[3] == port {
+				scheme = "gophers"
+			}
+			link := buildLink(line[2], line[3], string(line[0][0]), line[1], scheme)
 			links = append(links, link)
 			linkNum := fmt.Sprintf("[%d]",len(links))
-			linktext := fmt.Sprintf("%s %5s  %s", getType(string(line[0][0])), linkNum, title)
+			// Gopher+ items are marked with a '+' beside their type
+			plus := " "
+			if len(line) > 4 && strings.HasPrefix(line[4], "+") {
+				plus = "+"
+			}
+			linktext := fmt.Sprintf("%s%s%5s  %s", getType(string(line[0][0])), plus, linkNum, title)
 			splitContent[i] = linktext
 		}
 	}
@@ -159,19 +338,19 @@ func parseMap(text string) (string, []string) {
 // based on their protocol.
 func IsDownloadOnly(gophertype string) bool {
 	switch gophertype {
-	case "0", "1", "3", "7", "h":
+	case "0", "1", "2", "3", "7", "h":
 		return false
 	default:
 		return true
 	}
 }
 
-func buildLink(host, port, gtype, resource string) string {
+func buildLink(host, port, gtype, resource, scheme string) string {
 	switch gtype {
 	case "8", "T":
-		return fmt.Sprintf("telnet://%s:%s", host, port)
+		return fmt.Sprintf("telnet://%s", net.JoinHostPort(host, port))
 	case "G":
-		return fmt.Sprintf("gemini://%s:%s%s", host, port, resource)
+		return fmt.Sprintf("gemini://%s%s", net.JoinHostPort(host, port), resource)
 	case "h":
 		u, tf := isWebLink(resource)
 		if tf {
@@ -181,8 +360,8 @@ func buildLink(host, port, gtype, resource string) string {
 				return fmt.Sprintf("http://%s", u)
 			}
 		}
-		return fmt.Sprintf("gopher://%s:%s/h%s", host, port, resource)
+		return fmt.Sprintf("%s://%s/h%s", scheme, net.JoinHostPort(host, port), resource)
 	default:
-		return fmt.Sprintf("gopher://%s:%s/%s%s", host, port, gtype, resource)
+		return fmt.Sprintf("%s://%s/%s%s", scheme, net.JoinHostPort(host, port), gtype, resource)
 	}
 }
@@ -0,0 +1,50 @@
+package gopher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Parse_Link_Schemes(t *testing.T) {
+	menu := "1Same server\t/phlog\texample.org\t70\r\n" +
+		"1Same host, other port\t/\texample.org\t7070\r\n" +
+		"0Other host\t/about.txt\tother.example\t70\r\n" +
+		"hWeb link\tURL:https://example.org/\texample.org\t70\r\n" +
+		"iInformation\t\terror.host\t1\r\n" +
+		".\r\n"
+
+	tests := []struct {
+		name    string
+		secure  bool
+		expects []string
+	}{
+		{
+			"Plain gopher menu",
+			false,
+			[]string{
+				"gopher://example.org:70/1/phlog",
+				"gopher://example.org:7070/1/",
+				"gopher://other.example:70/0/about.txt",
+				"https://example.org/",
+			},
+		},
+		{
+			"Gophers menu keeps TLS for its own server",
+			true,
+			[]string{
+				"gophers://example.org:70/1/phlog",
+				"gopher://example.org:7070/1/",
+				"gopher://other.example:70/0/about.txt",
+				"https://example.org/",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, links := Parse("1", []byte(menu), "Example.org", "70", tt.secure)
+			if !reflect.DeepEqual(links, tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %s", tt.name, tt.expects, links)
+			}
+		})
+	}
+}
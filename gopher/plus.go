@@ -0,0 +1,338 @@
+package gopher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"tildegit.org/sloum/bombadillo/stream"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// Attributes are the Gopher+ attribute blocks of an item.
+// The INFO, ADMIN and VIEWS blocks are parsed, any others
+// are kept as text in the order they were received.
+type Attributes struct {
+	Info     string
+	Admin    string
+	Modified time.Time
+	Views    []View
+	Other    []string
+}
+
+// View is a representation a Gopher+ item is offered in
+type View struct {
+	Mime     string
+	Language string
+	Size     string
+}
+
+// terminatorWriter passes writes on to w, holding back the
+// last few bytes so that the terminating line of a Gopher+
+// response can be left out once the response has been read
+type terminatorWriter struct {
+	w    io.Writer
+	held []byte
+}
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+func (t *terminatorWriter) Write(p []byte) (int, error) {
+	data := append(t.held, p...)
+	keep := len(".\r\n")
+	if len(data) <= keep {
+		t.held = data
+		return len(p), nil
+	}
+	_, err := t.w.Write(data[:len(data)-keep])
+	t.held = append([]byte{}, data[len(data)-keep:]...)
+	return len(p), err
+}
+
+// Close writes the bytes held back, without the terminating
+// line
+func (t *terminatorWriter) Close() error {
+	_, err := t.w.Write(trimTerminator(t.held))
+	return err
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// SplitRequest separates a gopher resource into its selector,
+// search and Gopher+ string, using the tab separated form of
+// gopher urls. The Gopher+ string is "!" for an attribute
+// request or "+" followed by a view.
+func SplitRequest(resource string) (string, string, string) {
+	fields := strings.SplitN(resource, "\t", 3)
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	return fields[0], fields[1], fields[2]
+}
+
+// requestLine returns the line sent to a server to request
+// resource. The search field is left out of Gopher+ requests
+// that do not have one.
+func requestLine(resource string) string {
+	selector, search, plus := SplitRequest(resource)
+	if plus == "" {
+		return resource + "\n"
+	} else if search == "" {
+		return selector + "\t" + plus + "\r\n"
+	}
+	return selector + "\t" + search + "\t" + plus + "\r\n"
+}
+
+// ParseAttributes parses the attribute blocks sent in reply
+// to an attribute request, which have had their Gopher+
+// header removed
+func ParseAttributes(data []byte) (Attributes, error) {
+	var out Attributes
+	var name string
+	var block []string
+	end := func() {
+		switch name {
+		case "INFO":
+			out.Info = strings.TrimSpace(strings.Join(block, " "))
+		case "ADMIN":
+			for _, ln := range block {
+				kv := strings.SplitN(strings.TrimSpace(ln), ":", 2)
+				if len(kv) < 2 {
+					continue
+				}
+				value := strings.TrimSpace(kv[1])
+				switch strings.ToLower(kv[0]) {
+				case "admin":
+					out.Admin = value
+				case "mod-date":
+					out.Modified = parseDate(value)
+				}
+			}
+		case "VIEWS":
+			for _, ln := range block {
+				if v, ok := parseView(ln); ok {
+					out.Views = append(out.Views, v)
+				}
+			}
+		case "":
+		default:
+			out.Other = append(out.Other, name+":")
+			out.Other = append(out.Other, block...)
+		}
+	}
+
+	for _, ln := range strings.Split(string(data), "\n") {
+		ln = strings.TrimRight(ln, "\r")
+		if strings.HasPrefix(ln, "+") {
+			end()
+			split := strings.SplitN(ln[1:], ":", 2)
+			name, block = strings.ToUpper(split[0]), []string{}
+			if len(split) > 1 && strings.TrimSpace(split[1]) != "" {
+				block = append(block, strings.TrimSpace(split[1]))
+			}
+		} else if ln != "" && ln != "." {
+			block = append(block, ln)
+		}
+	}
+	end()
+	if out.Info == "" && len(out.Views) == 0 {
+		return out, fmt.Errorf("The server did not send Gopher+ attributes for this item")
+	}
+	return out, nil
+}
+
+// ParseAttributePage renders the attributes sent in reply to
+// an attribute request for resource, an item of the given type
+// on host and port. Each view is a link that requests the item
+// in that view.
+func ParseAttributePage(gophertype, host, port, resource string, resp []byte, secure bool) (string, []string, error) {
+	attrs, err := ParseAttributes(resp)
+	if err != nil {
+		return "", []string{}, err
+	}
+	selector, _, _ := SplitRequest(resource)
+	scheme := "gopher"
+	if secure {
+		scheme = "gophers"
+	}
+
+	links := make([]string, 0, len(attrs.Views))
+	var out strings.Builder
+	title := selector
+	if info := strings.Split(attrs.Info, "\t"); len(info[0]) > 1 {
+		title = info[0][1:]
+	}
+	out.WriteString(fmt.Sprintf("           Gopher+ attributes of %s\n\n", title))
+	out.WriteString(fmt.Sprintf("           Type: %s\n", getType(gophertype)))
+	if attrs.Admin != "" {
+		out.WriteString(fmt.Sprintf("           Admin: %s\n", attrs.Admin))
+	}
+	if !attrs.Modified.IsZero() {
+		out.WriteString(fmt.Sprintf("           Modified: %s\n", attrs.Modified.Format("2006-01-02 15:04:05")))
+	}
+	if len(attrs.Views) > 0 {
+		out.WriteString("\n           Views:\n")
+	}
+	for _, v := range attrs.Views {
+		name := v.Mime
+		if v.Language != "" {
+			name += " " + v.Language
+		}
+		links = append(links, fmt.Sprintf("%s://%s/%s%s\t\t+%s", scheme, net.JoinHostPort(host, port), gophertype, selector, name))
+		linkNum := fmt.Sprintf("[%d]", len(links))
+		size := ""
+		if v.Size != "" {
+			size = " (" + v.Size + ")"
+		}
+		out.WriteString(fmt.Sprintf("%s %5s  %s%s\n", viewType(v.Mime), linkNum, name, size))
+	}
+	if len(attrs.Other) > 0 {
+		out.WriteString("\n")
+	}
+	for _, ln := range attrs.Other {
+		out.WriteString("           " + ln + "\n")
+	}
+	return out.String(), links, nil
+}
+
+// IsTextView reports whether a view can be shown as text
+func IsTextView(view string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(view, "+"), "text/")
+}
+
+// decodePlus removes the Gopher+ header from a complete
+// response, along with the terminating line of responses
+// whose length was not given. Error replies are returned as
+// errors.
+func decodePlus(resp []byte) ([]byte, error) {
+	nl := bytes.IndexByte(resp, '\n')
+	if nl < 0 {
+		return resp, fmt.Errorf("Invalid Gopher+ response from server")
+	}
+	size, err := plusHeader(string(resp[:nl]), resp[nl+1:])
+	if err != nil {
+		return []byte{}, err
+	}
+	body := resp[nl+1:]
+	if size == -1 {
+		body = trimTerminator(body)
+	} else if size >= 0 && size < int64(len(body)) {
+		body = body[:size]
+	}
+	return body, nil
+}
+
+// copyPlus writes a Gopher+ response read from r to w,
+// without its header
+func copyPlus(ctx context.Context, w io.Writer, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Invalid Gopher+ response from server")
+	}
+	var rest []byte
+	if strings.HasPrefix(header, "--") {
+		rest, _ = stream.ReadAll(ctx, reader)
+	}
+	size, err := plusHeader(header, rest)
+	if err != nil {
+		return err
+	}
+	switch {
+	case size == -1:
+		// Responses of unknown length end with a line
+		// holding a period, which is left out
+		tw := &terminatorWriter{w, []byte{}}
+		_, err := stream.Copy(ctx, tw, reader)
+		if err != nil {
+			return err
+		}
+		return tw.Close()
+	case size < 0:
+		_, err = stream.Copy(ctx, w, reader)
+		return err
+	default:
+		_, err = stream.Copy(ctx, w, io.LimitReader(reader, size))
+		return err
+	}
+}
+
+// plusHeader returns the length given in the header line of
+// a Gopher+ response: the number of bytes, -1 for a response
+// ending with a period line, or -2 for one ending when the
+// connection closes. For error replies the error message is
+// read from body.
+func plusHeader(header string, body []byte) (int64, error) {
+	header = strings.TrimSpace(header)
+	if strings.HasPrefix(header, "--") {
+		return 0, fmt.Errorf("Gopher+ error: %s", strings.TrimSpace(string(trimTerminator(body))))
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(header, "+"), 10, 64)
+	if !strings.HasPrefix(header, "+") || err != nil {
+		return 0, fmt.Errorf("The server did not send a Gopher+ response")
+	}
+	return size, nil
+}
+
+func trimTerminator(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte(".\r\n"))
+	return bytes.TrimSuffix(data, []byte(".\n"))
+}
+
+// parseView parses a line of a VIEWS block, such as
+// "text/plain En_US: <10k>"
+func parseView(ln string) (View, bool) {
+	var v View
+	split := strings.SplitN(strings.TrimSpace(ln), ":", 2)
+	fields := strings.Fields(split[0])
+	if len(fields) == 0 || !strings.Contains(fields[0], "/") {
+		return v, false
+	}
+	v.Mime = fields[0]
+	if len(fields) > 1 {
+		v.Language = fields[1]
+	}
+	if len(split) > 1 {
+		v.Size = strings.Trim(strings.TrimSpace(split[1]), "<>")
+	}
+	return v, true
+}
+
+// parseDate parses a Gopher+ date, such as "<20240131235959>"
+func parseDate(s string) time.Time {
+	if open := strings.LastIndex(s, "<"); open >= 0 {
+		s = s[open+1:]
+	}
+	t, err := time.Parse("20060102150405", strings.TrimSuffix(s, ">"))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// viewType returns the three letter type shown beside a view
+func viewType(mime string) string {
+	switch {
+	case strings.HasPrefix(mime, "text/"):
+		return "TXT"
+	case strings.HasPrefix(mime, "image/"):
+		return "IMG"
+	case strings.HasPrefix(mime, "audio/"):
+		return "SND"
+	default:
+		return "BIN"
+	}
+}
@@ -0,0 +1,143 @@
+package gopher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func Test_ParseAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects Attributes
+		fails   bool
+	}{
+		{
+			"All blocks",
+			"+INFO: 0About\t/about.txt\texample.org\t70\t+\r\n" +
+				"+ADMIN:\r\n" +
+				" Admin: Jo <jo@example.org>\r\n" +
+				" Mod-Date: Wed Jan 31 23:59:59 2024 <20240131235959>\r\n" +
+				"+VIEWS:\r\n" +
+				" text/plain: <10k>\r\n" +
+				" application/pdf En_US: <2M>\r\n" +
+				"+ABSTRACT:\r\n" +
+				" A short file\r\n" +
+				".\r\n",
+			Attributes{
+				"0About\t/about.txt\texample.org\t70\t+",
+				"Jo <jo@example.org>",
+				time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC),
+				[]View{{"text/plain", "", "10k"}, {"application/pdf", "En_US", "2M"}},
+				[]string{"ABSTRACT:", " A short file"},
+			},
+			false,
+		},
+		{
+			"Block names in lower case",
+			"+info: 1Menu\t/\texample.org\t70\t+\n+views:\n text/plain\n",
+			Attributes{Info: "1Menu\t/\texample.org\t70\t+", Views: []View{{"text/plain", "", ""}}},
+			false,
+		},
+		{
+			"View lines without a mime type are skipped",
+			"+VIEWS:\n text/plain: <1k>\n Not a view\n",
+			Attributes{Views: []View{{"text/plain", "", "1k"}}},
+			false,
+		},
+		{
+			"Date that cannot be read",
+			"+INFO: 0About\t/about.txt\texample.org\t70\t+\n+ADMIN:\n Mod-Date: <yesterday>\n",
+			Attributes{Info: "0About\t/about.txt\texample.org\t70\t+"},
+			false,
+		},
+		{
+			"No info or views",
+			"+ADMIN:\n Admin: Jo <jo@example.org>\n",
+			Attributes{Admin: "Jo <jo@example.org>"},
+			true,
+		},
+		{
+			"Empty reply",
+			"",
+			Attributes{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, err := ParseAttributes([]byte(tt.input))
+			if !reflect.DeepEqual(attrs, tt.expects) || (err != nil) != tt.fails {
+				t.Errorf("Test failed - %s\nexpects %#v, error %t\nactual  %#v, error %v", tt.name, tt.expects, tt.fails, attrs, err)
+			}
+		})
+	}
+}
+
+func Test_decodePlus(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects string
+		fails   bool
+	}{
+		{"Length given", "+5\r\nhello world", "hello", false},
+		{"Length longer than the body", "+20\r\nshort", "short", false},
+		{"Ends with a period line", "+-1\r\nfirst\r\nsecond\r\n.\r\n", "first\r\nsecond\r\n", false},
+		{"Ends with a bare period line", "+-1\nfirst\n.\n", "first\n", false},
+		{"Ends when the connection closes", "+-2\r\nall of it\r\n.\r\n", "all of it\r\n.\r\n", false},
+		{"Error reply", "--1\r\n1 Jo <jo@example.org>\r\nNot found\r\n.\r\n", "", true},
+		{"Header that is not Gopher+", "iHello\t\terror.host\t1\r\n", "", true},
+		{"No header line", "+5", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := decodePlus([]byte(tt.input))
+			if (err != nil) != tt.fails || (!tt.fails && string(body) != tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %q, error %t\nactual  %q, error %v", tt.name, tt.expects, tt.fails, body, err)
+			}
+		})
+	}
+}
+
+func Test_copyPlus(t *testing.T) {
+	long := strings.Repeat("0123456789", 5000)
+	tests := []struct {
+		name    string
+		input   string
+		expects string
+		fails   bool
+	}{
+		{"Length given", "+5\r\nhello world", "hello", false},
+		{"Ends with a period line", "+-1\r\nfirst\r\nsecond\r\n.\r\n", "first\r\nsecond\r\n", false},
+		{"Ends with a bare period line", "+-1\nfirst\n.\n", "first\n", false},
+		{"Long response ending with a period line", "+-1\r\n" + long + "\r\n.\r\n", long + "\r\n", false},
+		{"Short response ending with a period line", "+-1\r\n.\r\n", "", false},
+		{"Ends when the connection closes", "+-2\r\nall of it\r\n.\r\n", "all of it\r\n.\r\n", false},
+		{"Error reply", "--1\r\n1 Jo <jo@example.org>\r\nNot found\r\n.\r\n", "", true},
+		{"No header line", "+5", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading a byte at a time splits the terminating
+			// line across writes
+			readers := map[string]io.Reader{
+				"whole":            strings.NewReader(tt.input),
+				"a byte at a time": iotest.OneByteReader(strings.NewReader(tt.input)),
+			}
+			for how, r := range readers {
+				var out bytes.Buffer
+				err := copyPlus(context.Background(), &out, r)
+				if (err != nil) != tt.fails || (!tt.fails && out.String() != tt.expects) {
+					t.Errorf("Test failed - %s, read %s\nexpects %q, error %t\nactual  %q, error %v", tt.name, how, tt.expects, tt.fails, out.String(), err)
+				}
+			}
+		})
+	}
+}
@@ -9,11 +9,12 @@ import (
 //--------------------------------------------------\\
 
 // Headbar represents the contents of the top bar of
-// the client and contains the client name and the
-// current URL
+// the client and contains the client name, the current
+// URL and whether the page arrived encrypted
 type Headbar struct {
-	title string
-	url   string
+	title    string
+	url      string
+	security string
 }
 
 //------------------------------------------------\\
@@ -23,10 +24,14 @@ type Headbar struct {
 // Render returns a string with the contents of theHeadbar
 func (h *Headbar) Render(width int, theme string) string {
 	maxMsgWidth := width - len([]rune(h.title)) - 2
+	msg := h.url
+	if h.security != "" {
+		msg = h.security + " " + h.url
+	}
 	if theme == "inverse" {
-		return fmt.Sprintf("\033[7m%s▟\033[27m %-*.*s\033[0m", h.title, maxMsgWidth, maxMsgWidth, h.url)
+		return fmt.Sprintf("\033[7m%s▟\033[27m %-*.*s\033[0m", h.title, maxMsgWidth, maxMsgWidth, msg)
 	}
-	return fmt.Sprintf("%s▟\033[7m %-*.*s\033[0m", h.title, maxMsgWidth, maxMsgWidth, h.url)
+	return fmt.Sprintf("%s▟\033[7m %-*.*s\033[0m", h.title, maxMsgWidth, maxMsgWidth, msg)
 }
 
 //------------------------------------------------\\
@@ -35,5 +40,5 @@ func (h *Headbar) Render(width int, theme string) string {
 
 // MakeHeadbar returns a Headbar with default values
 func MakeHeadbar(title string) Headbar {
-	return Headbar{title, ""}
+	return Headbar{title, "", ""}
 }
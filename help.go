@@ -6,11 +6,18 @@ var ERRS = map[string]string{
 	"ADD":       "`add [target] [name...]`",
 	"D":         "`d [bookmark-id]`",
 	"DELETE":    "`delete [bookmark-id]`",
-	"B":         "`b [[bookmark-id]]`",
-	"BOOKMARKS": "`bookmarks [[bookmark-id]]`",
+	"ENGINES":   "`engines` or `engines add [keyword] [url] [[name...]]` or `engines delete [keyword]`",
+	"B":         "`b [[bookmark-id]]` or `b [move|rename|tag|note|info] [bookmark-id] [[value...]]` or `b [toggle|filter] [[folder|tag]]` or `b [import|export] [format] [[path]]`",
+	"BOOKMARKS": "`bookmarks [[bookmark-id]]` or `bookmarks [move|rename|tag|note|info] [bookmark-id] [[value...]]` or `bookmarks [toggle|filter] [[folder|tag]]` or `bookmarks check` or `bookmarks [import|export] [format] [[path]]`",
 	"C":         "`c [link_id]` or `c [setting]`",
+	"CACHE":     "`cache [[stats|purge]]`",
+	"CERTS":     "`certs`",
 	"CHECK":     "`check [link_id]` or `check [setting]`",
 	"H":         "`h`",
+	"INFO":      "`info` or `info [link_id]`",
+	"ID":        "`id [[list|rename|export|delete]] [[name]] [[value]]`",
+	"IDENTITY":  "`identity [[list|rename|export|delete]] [[name]] [[value]]`",
+	"HISTORY":   "`history [[clear]]`",
 	"HOME":      "`home`",
 	"J":         "`j [[history_position]]`",
 	"JUMP":      "`jump [[history_position]]`",
@@ -20,9 +27,13 @@ var ERRS = map[string]string{
 	"QUIT":      "`quit`",
 	"R":         "`r`",
 	"RELOAD":    "`reload`",
-	"SEARCH":    "`search [[keyword(s)...]]`",
+	"SEARCH":    "`search [[engine]] [[keyword(s)...]]`",
+	"SEARCHES":  "`searches [[name]]` or `searches [save|delete] [name]`",
 	"S":         "`s [setting] [value]`",
+	"SESSION":   "`session [[list|save|load|delete]] [[name]]`",
 	"SET":       "`set [setting] [value]`",
+	"TAB":       "`tab [[tab_id|new|close|list]] [[target]]`",
+	"UPLOAD":    "`upload [[path|edit]] [[token]]`",
 	"W":         "`w [target]`",
 	"WRITE":     "`write [target]`",
 	"VERSION":   "`version`",
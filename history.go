@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// HistoryEntry is a single url in the browsing history, along
+// with when it was last visited and how many times it has been
+type HistoryEntry struct {
+	Url     string
+	Title   string
+	Visited time.Time
+	Count   int
+}
+
+// HistoryStore is the persistent browsing history of the client.
+// Every visit is appended to a file in the config location so
+// that the history survives a restart, there is no size limit.
+type HistoryStore struct {
+	path    string
+	entries []HistoryEntry
+	index   map[string]int
+}
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Load reads the history file at path. Each line of the file
+// is a single visit: a unix timestamp, the url and the title,
+// separated by tabs. New visits will be appended to the file.
+func (h *HistoryStore) Load(path string) error {
+	h.path = path
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		title := ""
+		if len(fields) == 3 {
+			title = fields[2]
+		}
+		h.record(fields[1], title, time.Unix(ts, 0))
+	}
+	return scanner.Err()
+}
+
+// Add records a visit to url at the current time and writes
+// it to the history file
+func (h *HistoryStore) Add(url, title string) error {
+	// Tabs and newlines are the delimiters of the history file
+	clean := strings.NewReplacer("\t", " ", "\r", "", "\n", " ")
+	url = clean.Replace(url)
+	title = strings.TrimSpace(clean.Replace(title))
+	now := time.Now()
+	h.record(url, title, now)
+
+	if h.path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "%d\t%s\t%s\n", now.Unix(), url, title)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Clear removes all of the history, including the history file
+func (h *HistoryStore) Clear() error {
+	h.entries = h.entries[:0]
+	h.index = make(map[string]int)
+	if h.path == "" {
+		return nil
+	}
+	err := os.Remove(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Entries returns the history with the most recently
+// visited url first
+func (h *HistoryStore) Entries() []HistoryEntry {
+	out := make([]HistoryEntry, len(h.entries))
+	copy(out, h.entries)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Visited.After(out[j].Visited)
+	})
+	return out
+}
+
+// Render returns the history as page content, with a numbered
+// link for each entry, along with the slice of links
+func (h *HistoryStore) Render() (string, []string) {
+	entries := h.Entries()
+	links := make([]string, 0, len(entries))
+	var out strings.Builder
+	out.WriteString("Browsing History\n\n")
+	if len(entries) == 0 {
+		out.WriteString("Nothing has been visited yet\n")
+		return out.String(), links
+	}
+	for i, e := range entries {
+		title := e.Title
+		if title == "" {
+			title = e.Url
+		}
+		visits := "visit"
+		if e.Count != 1 {
+			visits = "visits"
+		}
+		out.WriteString(fmt.Sprintf("%-5s %s\n", fmt.Sprintf("[%d]", i+1), title))
+		out.WriteString(fmt.Sprintf("      %s\n", e.Url))
+		out.WriteString(fmt.Sprintf("      %s, %d %s\n\n", e.Visited.Format("2006-01-02 15:04"), e.Count, visits))
+		links = append(links, e.Url)
+	}
+	return out.String(), links
+}
+
+func (h *HistoryStore) record(url, title string, when time.Time) {
+	if i, ok := h.index[url]; ok {
+		h.entries[i].Count++
+		if when.After(h.entries[i].Visited) {
+			h.entries[i].Visited = when
+		}
+		if title != "" {
+			h.entries[i].Title = title
+		}
+		return
+	}
+	h.index[url] = len(h.entries)
+	h.entries = append(h.entries, HistoryEntry{url, title, when, 1})
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// MakeHistoryStore returns an empty HistoryStore
+func MakeHistoryStore() HistoryStore {
+	return HistoryStore{"", make([]HistoryEntry, 0), make(map[string]int)}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_HistoryStore_Load(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects []HistoryEntry
+	}{
+		{
+			"Visits to the same url are counted together",
+			"100\tgopher://a.example:70/1/\tA\n" +
+				"200\tgemini://b.example:1965/\tB\n" +
+				"300\tgopher://a.example:70/1/\t\n",
+			[]HistoryEntry{
+				{"gopher://a.example:70/1/", "A", time.Unix(300, 0), 2},
+				{"gemini://b.example:1965/", "B", time.Unix(200, 0), 1},
+			},
+		},
+		{
+			"A later title replaces an earlier one",
+			"100\tgemini://b.example:1965/\tOld\n" +
+				"200\tgemini://b.example:1965/\tNew\n",
+			[]HistoryEntry{
+				{"gemini://b.example:1965/", "New", time.Unix(200, 0), 2},
+			},
+		},
+		{
+			"Malformed lines are skipped",
+			"not a time\tgopher://a.example:70/1/\tA\n" +
+				"100\n" +
+				"100\tfinger://c.example:79/\n",
+			[]HistoryEntry{
+				{"finger://c.example:79/", "", time.Unix(100, 0), 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "history")
+			err := ioutil.WriteFile(path, []byte(tt.input), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := MakeHistoryStore()
+			err = h.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(h.Entries(), tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %v\nactual  %v", tt.name, tt.expects, h.Entries())
+			}
+		})
+	}
+}
+
+func Test_HistoryStore_Add_Clear(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history")
+
+	h := MakeHistoryStore()
+	_ = h.Load(path)
+	_ = h.Add("gemini://b.example:1965/", "Tab\tand\nnewline ")
+	_ = h.Add("gemini://b.example:1965/", "")
+
+	reloaded := MakeHistoryStore()
+	_ = reloaded.Load(path)
+	entries := reloaded.Entries()
+	if len(entries) != 1 || entries[0].Title != "Tab and newline" || entries[0].Count != 2 {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %v", "Added visits are written to the file", "one entry titled \"Tab and newline\" with two visits", entries)
+	}
+
+	err := reloaded.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) || len(reloaded.Entries()) != 0 {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %v", "Clear removes the history", "no entries and no file", reloaded.Entries())
+	}
+}
+
+// tempDir makes a directory for a test to write files in
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bombadillo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -1,11 +1,14 @@
 package http
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"os/exec"
 	"strings"
+
+	"tildegit.org/sloum/bombadillo/stream"
 )
 
 // Page represents the contents and links or an http/https document
@@ -17,7 +20,7 @@ type Page struct {
 // Visit is the main entry to viewing a web document in bombadillo.
 // It takes a url, a terminal width, and which web backend the user
 // currently has set. Visit returns a Page and an error
-func Visit(webmode, url string, width int) (Page, error) {
+func Visit(ctx context.Context, webmode, url string, width int) (Page, error) {
 	if width > 80 {
 		width = 80
 	}
@@ -32,7 +35,7 @@ func Visit(webmode, url string, width int) (Page, error) {
 	default:
 		return Page{}, fmt.Errorf("Invalid webmode setting")
 	}
-	c, err := exec.Command(webmode, "-dump", w, fmt.Sprintf("%d", width), url).Output()
+	c, err := exec.CommandContext(ctx, webmode, "-dump", w, fmt.Sprintf("%d", width), url).Output()
 	if err != nil && c == nil {
 		return Page{}, err
 	}
@@ -42,11 +45,16 @@ func Visit(webmode, url string, width int) (Page, error) {
 // IsTextFile makes an http(s) head request to a given URL
 // and determines if the content-type is text based. It then
 // returns a bool
-func IsTextFile(url string) bool {
-	resp, err := http.Head(url)
+func IsTextFile(ctx context.Context, url string) bool {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return false
 	}
+	resp.Body.Close()
 	ctype := resp.Header.Get("content-type")
 	if strings.Contains(ctype, "text") || ctype == "" {
 		return true
@@ -79,20 +87,41 @@ func parseLinks(c string) Page {
 	return out
 }
 
-// Fetch makes an http(s) request and returns the []bytes
-// for the response and an error. Fetch is used for saving
-// the source file of an http(s) document
-func Fetch(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// Status makes an http(s) head request to a given URL without
+// following redirects. It returns the status code and, for a
+// redirect, the location being redirected to.
+func Status(ctx context.Context, url string) (int, string, error) {
+	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
-		return []byte{}, err
+		return 0, "", err
 	}
-	defer resp.Body.Close()
+	client := http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("location"), nil
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+// Download makes an http(s) request and writes the response
+// body to w as it is received. Download is used for saving
+// the source file of an http(s) document
+func Download(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return []byte{}, err
+		return err
 	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-	return bodyBytes, nil
+	_, err = stream.Copy(ctx, w, resp.Body)
+	return err
 }
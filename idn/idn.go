@@ -0,0 +1,244 @@
+// Package idn converts internationalized domain names to and
+// from the ASCII form used on the wire, with the punycode
+// encoding of RFC 3492. Labels are case folded but otherwise
+// used as entered, without the full IDNA mapping tables.
+package idn
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//------------------------------------------------\\
+// + + +          V A R I A B L E S          + + + \\
+//--------------------------------------------------\\
+
+const (
+	acePrefix   = "xn--"
+	maxLabel    = 63
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+	maxInt      = int(^uint32(0) >> 1)
+)
+
+// dots are the characters that separate labels, the full
+// stops of some scripts are accepted as well as '.'
+var dots = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// ToASCII returns host with each label that is not ASCII
+// lower cased and punycode encoded, with the "xn--" prefix.
+// ASCII labels are left as they are.
+func ToASCII(host string) (string, error) {
+	if isASCII(host) {
+		return host, nil
+	}
+	labels := strings.Split(dots.Replace(host), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := Encode(strings.ToLower(label))
+		if err != nil {
+			return "", err
+		}
+		labels[i] = acePrefix + encoded
+		if len(labels[i]) > maxLabel {
+			return "", fmt.Errorf("The domain name label %q is too long", label)
+		}
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode returns host with its punycode labels decoded.
+// Labels that do not decode are left as they are.
+func ToUnicode(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if len(label) <= len(acePrefix) || !strings.EqualFold(label[:len(acePrefix)], acePrefix) {
+			continue
+		}
+		if decoded, err := Decode(label[len(acePrefix):]); err == nil {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Encode returns the punycode encoding of a single label,
+// without the "xn--" prefix
+func Encode(label string) (string, error) {
+	if !utf8.ValidString(label) {
+		return "", fmt.Errorf("Invalid utf-8 in domain name label")
+	}
+	input := []rune(label)
+	var out strings.Builder
+	for _, r := range input {
+		if r < initialN {
+			out.WriteRune(r)
+		}
+	}
+	b := out.Len()
+	h := b
+	if b > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := initialN, 0, initialBias
+	for h < len(input) {
+		// Find the smallest code point not yet handled
+		m := maxInt
+		for _, r := range input {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if m-n > (maxInt-delta)/(h+1) {
+			return "", fmt.Errorf("Domain name label %q overflows punycode", label)
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if int(r) < n {
+				delta++
+			} else if int(r) == n {
+				q := delta
+				for k := base; ; k += base {
+					t := threshold(k, bias)
+					if q < t {
+						break
+					}
+					out.WriteByte(digit(t + (q-t)%(base-t)))
+					q = (q - t) / (base - t)
+				}
+				out.WriteByte(digit(q))
+				bias = adapt(delta, h+1, h == b)
+				delta = 0
+				h++
+			}
+		}
+		delta++
+		n++
+	}
+	return out.String(), nil
+}
+
+// Decode returns the label encoded by the punycode string s,
+// which does not have the "xn--" prefix
+func Decode(s string) (string, error) {
+	output := []rune{}
+	pos := 0
+	if b := strings.LastIndex(s, "-"); b > 0 {
+		for i := 0; i < b; i++ {
+			if s[i] >= initialN {
+				return "", fmt.Errorf("Invalid punycode %q", s)
+			}
+			output = append(output, rune(s[i]))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(s) {
+				return "", fmt.Errorf("Invalid punycode %q", s)
+			}
+			d, ok := decodeDigit(s[pos])
+			pos++
+			if !ok || d > (maxInt-i)/w {
+				return "", fmt.Errorf("Invalid punycode %q", s)
+			}
+			i += d * w
+			t := threshold(k, bias)
+			if d < t {
+				break
+			}
+			if w > maxInt/(base-t) {
+				return "", fmt.Errorf("Invalid punycode %q", s)
+			}
+			w *= base - t
+		}
+		length := len(output) + 1
+		bias = adapt(i-oldi, length, oldi == 0)
+		if i/length > maxInt-n {
+			return "", fmt.Errorf("Invalid punycode %q", s)
+		}
+		n += i / length
+		i %= length
+		if n > utf8.MaxRune {
+			return "", fmt.Errorf("Invalid punycode %q", s)
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
+
+// adapt is the bias adaptation function of RFC 3492
+func adapt(delta, points int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((base-tmin)*tmax)/2 {
+		delta /= base - tmin
+		k += base
+	}
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+func threshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return tmin
+	case k >= bias+tmax:
+		return tmax
+	default:
+		return k - bias
+	}
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func decodeDigit(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	default:
+		return 0, false
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
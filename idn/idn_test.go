@@ -0,0 +1,43 @@
+package idn
+
+import "testing"
+
+func Test_Punycode_Round_Trip(t *testing.T) {
+	// Samples from RFC 3492 section 7.1, with the
+	// case annotations removed
+	tests := []struct {
+		label   string
+		encoded string
+	}{
+		{"ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+		{"Pročprostěnemluvíčesky", "Proprostnemluvesky-uyb24dma41a"},
+		{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+		{"bücher", "bcher-kva"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			encoded, err := Encode(tt.label)
+			if err != nil || encoded != tt.encoded {
+				t.Errorf("Test failed - encoding %s\nexpects %s\nactual  %s %v", tt.label, tt.encoded, encoded, err)
+			}
+			decoded, err := Decode(tt.encoded)
+			if err != nil || decoded != tt.label {
+				t.Errorf("Test failed - decoding %s\nexpects %s\nactual  %s %v", tt.encoded, tt.label, decoded, err)
+			}
+		})
+	}
+}
+
+func Test_Host_Conversion(t *testing.T) {
+	ascii, err := ToASCII("Bücher。example.org")
+	if err != nil || ascii != "xn--bcher-kva.example.org" {
+		t.Errorf("Test failed - ToASCII\nexpects xn--bcher-kva.example.org\nactual  %s %v", ascii, err)
+	}
+	if host := ToUnicode(ascii); host != "bücher.example.org" {
+		t.Errorf("Test failed - ToUnicode\nexpects bücher.example.org\nactual  %s", host)
+	}
+	if host := ToUnicode("xn--!!.example.org"); host != "xn--!!.example.org" {
+		t.Errorf("Test failed - ToUnicode of invalid punycode\nexpects xn--!!.example.org\nactual  %s", host)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tildegit.org/sloum/bombadillo/finger"
+	"tildegit.org/sloum/bombadillo/gemini"
+	"tildegit.org/sloum/bombadillo/gopher"
+	"tildegit.org/sloum/bombadillo/http"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// LinkProblem is a bookmark that failed its check. Target is
+// set when the bookmark redirects, and is the url it should
+// be updated to.
+type LinkProblem struct {
+	Title   string
+	Link    string
+	Problem string
+	Target  string
+}
+
+// LinkChecker checks bookmarks in the background. It is safe
+// to use from more than one goroutine.
+type LinkChecker struct {
+	mu       sync.Mutex
+	running  bool
+	started  time.Time
+	checked  int
+	total    int
+	problems []LinkProblem
+}
+
+// linkCheckWorkers is the number of bookmarks checked at once
+const linkCheckWorkers = 4
+
+// linkCheckTimeout is the longest a single bookmark may take
+const linkCheckTimeout = 30 * time.Second
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Start checks each of the urls in the background with ctx,
+// calling done once every url has been checked. The titles are
+// used in the report. The certificates in td are copied, so
+// that the checks do not share them with the rest of the client.
+func (l *LinkChecker) Start(ctx context.Context, titles []string, urls []Url, td *gemini.TofuDigest, done func(problems int)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running {
+		return fmt.Errorf("Bookmarks are already being checked")
+	}
+	l.running = true
+	l.started = time.Now()
+	l.checked = 0
+	l.total = len(urls)
+	l.problems = make([]LinkProblem, 0, 10)
+	certs := td.Copy()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < linkCheckWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				digest := certs.Copy()
+				problem, target := checkLink(ctx, urls[i], &digest)
+				l.mu.Lock()
+				l.checked++
+				if problem != "" {
+					l.problems = append(l.problems, LinkProblem{titles[i], urls[i].Full, problem, target})
+				}
+				l.mu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		for i := range urls {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		l.mu.Lock()
+		l.running = false
+		count := len(l.problems)
+		l.mu.Unlock()
+		if done != nil {
+			done(count)
+		}
+	}()
+	return nil
+}
+
+// Problem returns the problem reported for link
+func (l *LinkChecker) Problem(link string) (LinkProblem, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range l.problems {
+		if p.Link == link {
+			return p, nil
+		}
+	}
+	return LinkProblem{}, fmt.Errorf("There is no bookmark check result for %s", link)
+}
+
+// Resolve removes every problem reported for link, once it
+// has been dealt with
+func (l *LinkChecker) Resolve(link string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := l.problems[:0]
+	for _, p := range l.problems {
+		if p.Link != link {
+			out = append(out, p)
+		}
+	}
+	l.problems = out
+}
+
+// Render returns the report as page content, along with the
+// slice of links. Each problem has a link that updates the
+// bookmark, where it redirects, and one that deletes it.
+func (l *LinkChecker) Render() (string, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	links := make([]string, 0, len(l.problems)*2)
+	var out strings.Builder
+	out.WriteString("Bookmark Check\n\n")
+	switch {
+	case l.started.IsZero():
+		out.WriteString("Bookmarks have not been checked, use 'bookmarks check' to start\n")
+		return out.String(), links
+	case l.running:
+		out.WriteString(fmt.Sprintf("Checking: %d of %d bookmarks done, reload to update\n\n", l.checked, l.total))
+	default:
+		out.WriteString(fmt.Sprintf("Checked %d bookmarks at %s\n\n", l.total, l.started.Format("2006-01-02 15:04")))
+	}
+	if len(l.problems) == 0 {
+		out.WriteString("No problems found\n")
+		return out.String(), links
+	}
+	for _, p := range l.problems {
+		out.WriteString(p.Title + "\n")
+		out.WriteString(fmt.Sprintf("      %s\n", p.Link))
+		out.WriteString(fmt.Sprintf("      %s\n", p.Problem))
+		if p.Target != "" {
+			links = append(links, "about:linkcheck/update/"+url.PathEscape(p.Link))
+			out.WriteString(fmt.Sprintf("%-5s Update bookmark to %s\n", fmt.Sprintf("[%d]", len(links)), p.Target))
+		}
+		links = append(links, "about:linkcheck/delete/"+url.PathEscape(p.Link))
+		out.WriteString(fmt.Sprintf("%-5s Delete bookmark\n\n", fmt.Sprintf("[%d]", len(links))))
+	}
+	return out.String(), links
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// checkLink requests u with ctx and describes what is wrong
+// with it, if anything. For redirects the new url is also
+// returned.
+func checkLink(ctx context.Context, u Url, td *gemini.TofuDigest) (string, string) {
+	ctx, cancel := context.WithTimeout(ctx, linkCheckTimeout)
+	defer cancel()
+
+	switch u.Scheme {
+	case "gopher", "gophers":
+		err := gopher.Check(ctx, u.Mime, u.Host, u.Port, u.Resource, u.Scheme == "gophers", td)
+		if _, ok := err.(*gemini.CertChangeError); ok {
+			return "The certificate has changed since it was last seen", ""
+		}
+		if err != nil {
+			return "Unreachable: " + err.Error(), ""
+		}
+	case "gemini":
+		status, meta, err := gemini.Status(ctx, u.Host, u.Port, u.Resource, td, nil)
+		if err != nil {
+			if _, ok := err.(*gemini.CertChangeError); ok {
+				return "The certificate has changed since it was last seen", ""
+			}
+			return "Unreachable: " + err.Error(), ""
+		}
+		switch status / 10 {
+		case 1, 2, 6:
+			// Input and client certificate requests are not
+			// problems with the bookmark
+		case 3:
+			target, err := gemini.HandleRelativeUrl(meta, u.Full)
+			if err != nil {
+				return "Redirects to an invalid url", ""
+			}
+			return fmt.Sprintf("[%d] Redirects to %s", status, target), target
+		default:
+			return gemini.StatusMessage(status, meta), ""
+		}
+	case "finger":
+		_, err := finger.Finger(ctx, u.Host, u.Port, u.Resource)
+		if err != nil {
+			return "Unreachable: " + err.Error(), ""
+		}
+	case "http", "https":
+		status, location, err := http.Status(ctx, u.Full)
+		if err != nil {
+			return "Unreachable: " + err.Error(), ""
+		}
+		if status >= 300 && status < 400 && location != "" {
+			target, err := gemini.HandleRelativeUrl(location, u.Full)
+			if err != nil {
+				return "Redirects to an invalid url", ""
+			}
+			return fmt.Sprintf("[%d] Redirects to %s", status, target), target
+		} else if status >= 400 {
+			return fmt.Sprintf("[%d] Error status", status), ""
+		}
+	case "local":
+		_, err := os.Stat(u.Resource)
+		if err != nil {
+			return "Unreachable: " + err.Error(), ""
+		}
+	}
+	return "", ""
+}
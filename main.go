@@ -33,6 +33,7 @@ import (
 	"tildegit.org/sloum/bombadillo/config"
 	"tildegit.org/sloum/bombadillo/cui"
 	"tildegit.org/sloum/bombadillo/gemini"
+	"tildegit.org/sloum/bombadillo/gopher"
 )
 
 var version string = "2.3.3"
@@ -41,10 +42,16 @@ var bombadillo *client
 var helplocation string = "gopher://bombadillo.colorfield.space:70/1/user-guide.map"
 var settings config.Config
 
+// startupErrors collects problems found while loading the
+// configuration, to be shown once the first page is up
+var startupErrors []string
+
 func saveConfig() error {
 	var opts strings.Builder
 	bkmrks := bombadillo.BookMarks.IniDump()
 	certs := bombadillo.Certs.IniDump()
+	identities := bombadillo.Identities.IniDump()
+	engines := bombadillo.Engines.IniDump()
 
 	opts.WriteString("\n[SETTINGS]\n")
 	for k, v := range bombadillo.Options {
@@ -58,16 +65,25 @@ func saveConfig() error {
 
 	opts.WriteString(certs)
 
+	opts.WriteString(identities)
+
+	opts.WriteString(engines)
+
 	return ioutil.WriteFile(filepath.Join(bombadillo.Options["configlocation"], ".bombadillo.ini"), []byte(opts.String()), 0644)
 }
 
 func validateOpt(opt, val string) bool {
 	var validOpts = map[string][]string{
-		"webmode":       []string{"none", "gui", "lynx", "w3m", "elinks"},
-		"theme":         []string{"normal", "inverse", "color"},
-		"defaultscheme": []string{"gopher", "gemini", "http", "https"},
-		"showimages":    []string{"true", "false"},
-		"geminiblocks":  []string{"block", "neither", "alt", "both"},
+		"webmode":         []string{"none", "gui", "lynx", "w3m", "elinks"},
+		"theme":           []string{"normal", "inverse", "color"},
+		"defaultscheme":   []string{"gopher", "gemini", "http", "https"},
+		"showimages":      []string{"true", "false"},
+		"savesession":     []string{"true", "false"},
+		"offline":         []string{"true", "false"},
+		"geminiblocks":    []string{"block", "neither", "alt", "both"},
+		"geminitls":       []string{"tofu", "ca", "either"},
+		"gophertls":       []string{"off", "opportunistic"},
+		"followredirects": []string{"none", "samehost", "crosshost", "crossscheme"},
 	}
 
 	opt = strings.ToLower(opt)
@@ -82,7 +98,7 @@ func validateOpt(opt, val string) bool {
 		return false
 	}
 
-	if opt == "timeout" {
+	if opt == "timeout" || opt == "maxredirects" || opt == "maxbodysize" || opt == "cachettl" || opt == "cachesize" {
 		_, err := strconv.Atoi(val)
 		if err != nil {
 			return false
@@ -94,7 +110,7 @@ func validateOpt(opt, val string) bool {
 
 func lowerCaseOpt(opt, val string) string {
 	switch opt {
-	case "webmode", "theme", "defaultscheme", "showimages", "geminiblocks":
+	case "webmode", "theme", "defaultscheme", "showimages", "geminiblocks", "geminitls", "gophertls", "followredirects", "savesession", "offline":
 		return strings.ToLower(val)
 	default:
 		return val
@@ -133,6 +149,15 @@ func loadConfig() {
 				bombadillo.Options[lowerkey] = v.Value
 				if lowerkey == "geminiblocks" {
 					gemini.BlockBehavior = v.Value
+				} else if lowerkey == "geminitls" {
+					gemini.TlsMode = strings.ToLower(v.Value)
+				} else if lowerkey == "gophertls" {
+					gopher.OpportunisticTLS = strings.ToLower(v.Value) == "opportunistic"
+				} else if lowerkey == "cabundle" {
+					err := updateCABundle(v.Value)
+					if err != nil {
+						startupErrors = append(startupErrors, fmt.Sprintf("Unable to load CA bundle: %s", err.Error()))
+					}
 				} else if lowerkey == "timeout" {
 					updateTimeouts(v.Value)
 				}
@@ -142,31 +167,48 @@ func loadConfig() {
 		}
 	}
 
-	for i, v := range settings.Bookmarks.Titles {
-		_, _ = bombadillo.BookMarks.Add([]string{v, settings.Bookmarks.Links[i]})
-	}
+	bombadillo.BookMarks.LoadIni(settings)
 
 	for _, v := range settings.Certs {
 		// Remove expired certs
-		vals := strings.SplitN(v.Value, "|", -1)
-		if len(vals) < 2 {
-			continue
-		}
-		now := time.Now()
-		ts, err := strconv.ParseInt(vals[1], 10, 64)
-		if err != nil || now.Unix() > ts {
+		cert, err := gemini.ParseCertEntry(v.Value)
+		if err != nil || time.Now().After(cert.Expires) {
 			continue
 		}
 		// Satisfied that the cert is not expired
 		// or malformed: add to the current client
 		// instance
-		bombadillo.Certs.Add(v.Key, vals[0], ts)
+		bombadillo.Certs.Add(v.Key, cert)
 	}
+
+	// Client certificates live beside .bombadillo.ini, the scopes
+	// they are used for are stored in the ini file itself
+	err = bombadillo.Identities.Load(filepath.Join(bombadillo.Options["configlocation"], ".bombadillo-identities"))
+	if err != nil {
+		startupErrors = append(startupErrors, err.Error())
+	}
+	for _, v := range settings.Identities {
+		_ = bombadillo.Identities.Assign(v.Key, v.Value)
+	}
+
+	if settings.SearchEngines != nil {
+		// Files written before engines could be edited have
+		// no section for them, and keep the default engines
+		bombadillo.Engines = SearchEngines{}
+		for _, v := range settings.SearchEngines {
+			uri, name := parseEngineEntry(v.Value)
+			_ = bombadillo.Engines.Add(v.Key, uri, name)
+		}
+	}
+
+	_ = bombadillo.History.Load(filepath.Join(bombadillo.Options["configlocation"], ".bombadillo.history"))
+	_ = bombadillo.Searches.Load(filepath.Join(bombadillo.Options["configlocation"], ".bombadillo-searches.json"))
 }
 
 func initClient() {
 	bombadillo = MakeClient("  ((( Bombadillo )))  ")
 	loadConfig()
+	_ = bombadillo.updateCache()
 }
 
 // In the event of specific signals, ensure the display is shown correctly.
@@ -183,11 +225,51 @@ func handleSignals(c <-chan os.Signal) {
 			cui.InitTerm()
 			bombadillo.Draw()
 		case syscall.SIGINT:
-			cui.Exit(130, "")
+			// Ctrl-C abandons a page load in progress,
+			// otherwise it quits
+			if !bombadillo.CancelLoad() {
+				quitFromSignal()
+			}
 		}
 	}
 }
 
+// quitFromSignal has the main loop quit, so that the session is
+// not saved while it is being changed. If the loop does not pick
+// it up it is waiting on a prompt, and it is safe to quit here.
+func quitFromSignal() {
+	started := make(chan struct{})
+	bombadillo.post(func() {
+		close(started)
+		bombadillo.Quit(130)
+	})
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		bombadillo.Quit(130)
+	}
+}
+
+// restoreSession loads the most recently saved session, if the
+// 'savesession' setting is on. It returns false if there was no
+// session to restore.
+func restoreSession() bool {
+	if bombadillo.Options["savesession"] != "true" {
+		return false
+	}
+	names, err := ListSessions()
+	if err != nil || len(names) == 0 {
+		return false
+	}
+	err = bombadillo.LoadSession(names[0])
+	if err != nil {
+		bombadillo.SetMessage(err.Error(), true)
+		bombadillo.DrawMessage()
+		return false
+	}
+	return true
+}
+
 //printHelp produces a nice display message when the --help flag is used
 func printHelp() {
 	art := `Bombadillo - a non-web browser
@@ -238,12 +320,16 @@ func main() {
 		// Goroutine so keypresses can be made during
 		// page load
 		bombadillo.Visit(args[0])
-	} else {
+	} else if !restoreSession() {
 		// Otherwise, load the homeurl
 		// Goroutine so keypresses can be made during
 		// page load
 		bombadillo.Visit(bombadillo.Options["homeurl"])
 	}
+	if len(startupErrors) > 0 {
+		bombadillo.SetMessage(strings.Join(startupErrors, "; "), true)
+		bombadillo.DrawMessage()
+	}
 
 	// Loop indefinitely on user input
 	for {
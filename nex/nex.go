@@ -0,0 +1,164 @@
+// Package nex retrieves documents with the nex protocol, a
+// plain text protocol in which a path is sent and the file or
+// directory listing it names is returned. Directory listings
+// are text, with lines beginning '=> ' linking to other items.
+package nex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"tildegit.org/sloum/bombadillo/stream"
+)
+
+//------------------------------------------------\\
+// + + +          V A R I A B L E S          + + + \\
+//--------------------------------------------------\\
+
+// textExtensions are read as text even where the system does
+// not know their mime type
+var textExtensions = map[string]bool{
+	"":          true,
+	".txt":      true,
+	".gmi":      true,
+	".gemini":   true,
+	".md":       true,
+	".markdown": true,
+	".log":      true,
+	".csv":      true,
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// Retrieve requests resource from host and returns the
+// response
+func Retrieve(ctx context.Context, host, port, resource string) ([]byte, error) {
+	conn, err := request(ctx, host, port, resource)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	return stream.ReadAll(ctx, conn)
+}
+
+// Download requests resource from host and writes the
+// response to w as it is received
+func Download(ctx context.Context, host, port, resource string, w io.Writer) error {
+	conn, err := request(ctx, host, port, resource)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	_, err = stream.Copy(ctx, w, conn)
+	return err
+}
+
+// IsDirectory reports whether resource names a directory,
+// whose response is a listing of links
+func IsDirectory(resource string) bool {
+	return resource == "" || strings.HasSuffix(resource, "/")
+}
+
+// IsText reports whether resource can be shown as text, based
+// on its extension. Directories are always text.
+func IsText(resource string) bool {
+	if IsDirectory(resource) {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(resource))
+	if textExtensions[ext] {
+		return true
+	}
+	return strings.HasPrefix(mime.TypeByExtension(ext), "text/")
+}
+
+// Parse turns the response to a request for resource into text
+// for display. Directory listings have their links numbered,
+// in the same way as gophermaps, and resolved against the url
+// of the directory.
+func Parse(resp []byte, host, port, resource string) (string, []string) {
+	text := string(resp)
+	if !IsDirectory(resource) {
+		return text, []string{}
+	}
+	base, err := url.Parse(fmt.Sprintf("nex://%s/%s", net.JoinHostPort(host, port), resource))
+	if err != nil {
+		return text, []string{}
+	}
+
+	splitContent := strings.Split(text, "\n")
+	links := make([]string, 0, 10)
+	for i, ln := range splitContent {
+		ln = strings.TrimRight(ln, "\r")
+		if !strings.HasPrefix(ln, "=>") {
+			splitContent[i] = "           " + ln
+			continue
+		}
+		fields := strings.Fields(ln[2:])
+		if len(fields) == 0 {
+			splitContent[i] = "           " + ln
+			continue
+		}
+		link := fields[0]
+		title := strings.TrimSpace(strings.TrimSpace(ln[2:])[len(link):])
+		if title == "" {
+			title = link
+		}
+		if rel, err := url.Parse(link); err == nil {
+			link = base.ResolveReference(rel).String()
+		}
+		links = append(links, link)
+		linkNum := fmt.Sprintf("[%d]", len(links))
+		splitContent[i] = fmt.Sprintf("%s %5s  %s", linkType(link), linkNum, title)
+	}
+	return strings.Join(splitContent, "\n"), links
+}
+
+// linkType returns the three letter type shown beside a link
+// in a directory listing
+func linkType(link string) string {
+	u, err := url.Parse(link)
+	switch {
+	case err != nil:
+		return "???"
+	case u.Scheme != "nex":
+		return "URL"
+	case IsDirectory(strings.TrimPrefix(u.Path, "/")):
+		return "DIR"
+	case IsText(u.Path):
+		return "TXT"
+	default:
+		return "BIN"
+	}
+}
+
+func request(ctx context.Context, host, port, resource string) (net.Conn, error) {
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Incomplete request url")
+	}
+	dialer := net.Dialer{Timeout: time.Duration(5) * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte(resource + "\r\n"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -26,6 +26,8 @@ type Page struct {
 	FileType       string
 	WrapWidth      int
 	Color          bool
+	Security       string
+	Encrypted      bool
 }
 
 //------------------------------------------------\\
@@ -185,13 +187,31 @@ func (p *Page) FindText() {
 	}
 }
 
+// Title returns the first heading of a gemini document, or
+// an empty string if the page does not have one
+func (p *Page) Title() string {
+	if p.Location.Scheme != "gemini" {
+		return ""
+	}
+	// Headings are emboldened when the document is parsed,
+	// which sets them apart from preformatted text
+	for _, ln := range strings.Split(p.RawContent, "\n") {
+		ln = strings.TrimLeft(ln, " ")
+		if strings.HasPrefix(ln, "\033[1m#") {
+			ln = strings.TrimSuffix(ln[4:], "\033[0m")
+			return strings.TrimSpace(strings.TrimLeft(ln, "#"))
+		}
+	}
+	return ""
+}
+
 //------------------------------------------------\\
 // + + +          F U N C T I O N S          + + + \\
 //--------------------------------------------------\\
 
 // MakePage returns a Page struct with default values
 func MakePage(url Url, content string, links []string) Page {
-	p := Page{make([]string, 0), content, links, url, 0, make([]int, 0), "", 0, "", 40, false}
+	p := Page{make([]string, 0), content, links, url, 0, make([]int, 0), "", 0, "", 40, false, "", false}
 	return p
 }
 
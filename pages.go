@@ -9,14 +9,19 @@ import (
 //--------------------------------------------------\\
 
 // Pages is a struct that represents the history of the client.
-// It functions as a container for the pages (history array) and
+// It functions as a container for the pages (history slice) and
 // tracks the current history length and location.
 type Pages struct {
 	Position int
 	Length   int
-	History  [20]Page
+	History  []Page
 }
 
+// maxPages is the number of pages a tab keeps in memory to go
+// back and forward through. Older visits are still kept in the
+// browsing history.
+const maxPages = 20
+
 //------------------------------------------------\\
 // + + +           R E C E I V E R S         + + + \\
 //--------------------------------------------------\\
@@ -38,23 +43,24 @@ func (p *Pages) NavigateHistory(qty int) error {
 }
 
 // Add gets passed a Page, which gets added to the history
-// array. Add also updates the current length and position
-// of the Pages struct to which it belongs. Add also shifts
-// off array items if necessary.
+// slice after the current position. Add also updates the
+// current length and position of the Pages struct to which
+// it belongs. Any forward history is discarded, and the oldest
+// page is shifted off once there are maxPages.
 func (p *Pages) Add(pg Page) {
-	if p.Position == p.Length-1 && p.Length < len(p.History) {
-		p.History[p.Length] = pg
-		p.Length++
-		p.Position++
-	} else if p.Position == p.Length-1 && p.Length == 20 {
-		for x := 1; x < len(p.History); x++ {
-			p.History[x-1] = p.History[x]
-		}
-		p.History[len(p.History)-1] = pg
-	} else {
-		p.Position++
-		p.Length = p.Position + 1
+	if p.Position >= maxPages-1 {
+		copy(p.History, p.History[1:maxPages])
+		p.History[maxPages-1] = pg
+		p.Position = maxPages - 1
+		p.Length = maxPages
+		return
+	}
+	p.Position++
+	p.Length = p.Position + 1
+	if p.Position < len(p.History) {
 		p.History[p.Position] = pg
+	} else {
+		p.History = append(p.History, pg)
 	}
 }
 
@@ -110,5 +116,5 @@ func (p *Pages) CopyHistory(pos int) error {
 
 // MakePages returns a Pages struct with default values
 func MakePages() Pages {
-	return Pages{-1, 0, [20]Page{}}
+	return Pages{-1, 0, make([]Page, 0, maxPages)}
 }
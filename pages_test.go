@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func Test_Pages_Add(t *testing.T) {
+	tests := []struct {
+		name     string
+		visits   int
+		back     int
+		expects  []int
+		position int
+	}{
+		{"A few pages", 3, 0, []int{1, 2, 3, 0}, 3},
+		{"Going back drops forward pages", 5, 3, []int{1, 2, 0}, 2},
+		{"Oldest pages are shifted off", maxPages + 5, 0, append(testPageRange(7, maxPages+5), 0), maxPages - 1},
+		{"Going back when full", maxPages + 5, 1, append(testPageRange(6, maxPages+4), 0), maxPages - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := MakePages()
+			for i := 1; i <= tt.visits; i++ {
+				pages.Add(testPage(i))
+			}
+			pages.Position -= tt.back
+			pages.Add(testPage(0))
+
+			actual := make([]int, 0, pages.Length)
+			for _, pg := range pages.History[:pages.Length] {
+				n, _ := strconv.Atoi(path.Base(pg.Location.Full))
+				actual = append(actual, n)
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(tt.expects) || pages.Position != tt.position || len(pages.History) > maxPages {
+				t.Errorf("Test failed - %s\nexpects %v at %d\nactual  %v at %d, %d pages held", tt.name, tt.expects, tt.position, actual, pages.Position, len(pages.History))
+			}
+		})
+	}
+}
+
+// testPage returns a page for the url gemini://example.org/<n>
+func testPage(n int) Page {
+	u, _ := MakeUrl(fmt.Sprintf("gemini://example.org:1965/%d", n))
+	return MakePage(u, "", []string{})
+}
+
+// testPageRange returns the numbers from first to last
+func testPageRange(first, last int) []int {
+	out := make([]int, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		out = append(out, i)
+	}
+	return out
+}
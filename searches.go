@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// SavedSearch is a query at a search endpoint that can be run
+// again. The links returned by the last run are kept so that
+// new results can be picked out.
+type SavedSearch struct {
+	Name    string
+	Url     string
+	Query   string
+	LastRun time.Time
+	Results []string
+	New     int
+}
+
+// SearchStore holds the queries made at each search endpoint,
+// oldest first, and the saved searches. It is written to disk
+// as json whenever it changes.
+type SearchStore struct {
+	Queries map[string][]string
+	Saved   []SavedSearch
+	path    string
+}
+
+// maxSearchHistory is the number of queries kept for each
+// endpoint
+const maxSearchHistory = 50
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Load reads the search file at path, changes will be
+// written back to it
+func (s *SearchStore) Load(path string) error {
+	s.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, s)
+	if s.Queries == nil {
+		s.Queries = make(map[string][]string)
+	}
+	return err
+}
+
+// Record adds query to the history of endpoint. A query that
+// was already there is moved to the end.
+func (s *SearchStore) Record(endpoint, query string) error {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	queries := make([]string, 0, len(s.Queries[endpoint])+1)
+	for _, q := range s.Queries[endpoint] {
+		if q != query {
+			queries = append(queries, q)
+		}
+	}
+	queries = append(queries, query)
+	if len(queries) > maxSearchHistory {
+		queries = queries[len(queries)-maxSearchHistory:]
+	}
+	s.Queries[endpoint] = queries
+	return s.write()
+}
+
+// History returns the queries made at endpoint, oldest first
+func (s *SearchStore) History(endpoint string) []string {
+	return s.Queries[endpoint]
+}
+
+// Save stores the search that produced the page at u under
+// name, replacing any saved search with the same name
+func (s *SearchStore) Save(name string, u Url) error {
+	_, query, ok := splitSearchUrl(u)
+	if !ok {
+		return fmt.Errorf("The current page is not the result of a search")
+	}
+	search := SavedSearch{name, u.Full, query, time.Time{}, []string{}, 0}
+	if i, ok := s.Find(name); ok {
+		s.Saved[i] = search
+	} else {
+		s.Saved = append(s.Saved, search)
+	}
+	return s.write()
+}
+
+// Find returns the index of the saved search called name
+func (s *SearchStore) Find(name string) (int, bool) {
+	for i, search := range s.Saved {
+		if search.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Delete removes the saved search at index i
+func (s *SearchStore) Delete(i int) error {
+	if i < 0 || i >= len(s.Saved) {
+		return fmt.Errorf("There is no saved search %d", i)
+	}
+	s.Saved = append(s.Saved[:i], s.Saved[i+1:]...)
+	return s.write()
+}
+
+// Update records the links returned by a run of the saved
+// search at index i, returning the link numbers (counting
+// from one) of the results that were not returned last time
+func (s *SearchStore) Update(i int, links []string) ([]int, error) {
+	if i < 0 || i >= len(s.Saved) {
+		return []int{}, fmt.Errorf("There is no saved search %d", i)
+	}
+	seen := make(map[string]bool, len(s.Saved[i].Results))
+	for _, link := range s.Saved[i].Results {
+		seen[link] = true
+	}
+	fresh := make([]int, 0, 10)
+	for n, link := range links {
+		if !seen[link] {
+			fresh = append(fresh, n+1)
+		}
+	}
+	s.Saved[i].Results = append([]string{}, links...)
+	s.Saved[i].LastRun = time.Now()
+	s.Saved[i].New = len(fresh)
+	return fresh, s.write()
+}
+
+// Render returns the saved searches as page content, along
+// with the slice of links. Each search has a link that runs
+// it and one that deletes it.
+func (s *SearchStore) Render() (string, []string) {
+	links := make([]string, 0, len(s.Saved)*2)
+	var out strings.Builder
+	out.WriteString("Saved Searches\n\n")
+	if len(s.Saved) == 0 {
+		out.WriteString("There are no saved searches, use 'searches save [name]' on a page of search results\n")
+		return out.String(), links
+	}
+	for _, search := range s.Saved {
+		out.WriteString(search.Name + "\n")
+		out.WriteString(fmt.Sprintf("      %q at %s\n", search.Query, strings.Replace(search.Url, "\t", "%09", -1)))
+		if search.LastRun.IsZero() {
+			out.WriteString("      Not run yet\n")
+		} else {
+			out.WriteString(fmt.Sprintf("      Last run %s, %d results, %d new\n", search.LastRun.Format("2006-01-02 15:04"), len(search.Results), search.New))
+		}
+		links = append(links, "about:searches/run/"+url.PathEscape(search.Name))
+		out.WriteString(fmt.Sprintf("%-5s Run\n", fmt.Sprintf("[%d]", len(links))))
+		links = append(links, "about:searches/delete/"+url.PathEscape(search.Name))
+		out.WriteString(fmt.Sprintf("%-5s Delete\n\n", fmt.Sprintf("[%d]", len(links))))
+	}
+	return out.String(), links
+}
+
+func (s *SearchStore) write() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0600)
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// MakeSearchStore returns an empty SearchStore
+func MakeSearchStore() SearchStore {
+	return SearchStore{make(map[string][]string), make([]SavedSearch, 0), ""}
+}
+
+// splitSearchUrl separates a search url into its endpoint and
+// query. Gopher queries follow a tab, other queries follow a
+// '?' and are unescaped.
+func splitSearchUrl(u Url) (string, string, bool) {
+	sep := "?"
+	if u.Scheme == "gopher" || u.Scheme == "gophers" {
+		sep = "\t"
+	}
+	ind := strings.Index(u.Full, sep)
+	if ind < 0 {
+		return u.Full, "", false
+	}
+	query := u.Full[ind+1:]
+	if sep == "?" {
+		if unescaped, err := url.PathUnescape(query); err == nil {
+			query = unescaped
+		}
+	} else if tab := strings.Index(query, "\t"); tab >= 0 {
+		// A Gopher+ string may follow the query
+		query = query[:tab]
+	}
+	return u.Full[:ind], query, query != ""
+}
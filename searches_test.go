@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_SearchStore_Record(t *testing.T) {
+	many := make([]string, 0, maxSearchHistory+1)
+	for i := 0; i <= maxSearchHistory; i++ {
+		many = append(many, fmt.Sprintf("query %d", i))
+	}
+
+	tests := []struct {
+		name    string
+		input   []string
+		expects []string
+	}{
+		{"Queries kept oldest first", []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{"Repeated query moves to the end", []string{"a", "b", "a"}, []string{"b", "a"}},
+		{"Blank queries are not kept", []string{"a", " ", ""}, []string{"a"}},
+		{"Oldest queries are dropped", many, many[1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "searches.json")
+
+			s := MakeSearchStore()
+			_ = s.Load(path)
+			_ = s.Record("gopher://other.example:70/7/", "other")
+			for _, q := range tt.input {
+				err := s.Record("gopher://example.org:70/7/", q)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reloaded := MakeSearchStore()
+			err := reloaded.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := reloaded.History("gopher://example.org:70/7/")
+			if !reflect.DeepEqual(actual, tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %v\nactual  %v", tt.name, tt.expects, actual)
+			}
+			other := reloaded.History("gopher://other.example:70/7/")
+			if !reflect.DeepEqual(other, []string{"other"}) {
+				t.Errorf("Test failed - %s\nexpects %v\nactual  %v", tt.name, []string{"other"}, other)
+			}
+		})
+	}
+}
+
+func Test_SearchStore_Update(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []string
+		links    []string
+		expects  []int
+	}{
+		{"First run", []string{}, []string{"a", "b"}, []int{1, 2}},
+		{"Same results", []string{"a", "b"}, []string{"b", "a"}, []int{}},
+		{"New results among old ones", []string{"a", "b"}, []string{"c", "a", "d"}, []int{1, 3}},
+		{"No results", []string{"a"}, []string{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MakeSearchStore()
+			s.Saved = []SavedSearch{
+				{Name: "other", Results: []string{"x"}},
+				{Name: "test", Results: tt.previous},
+			}
+			fresh, err := s.Update(1, tt.links)
+			if err != nil {
+				t.Fatal(err)
+			}
+			search := s.Saved[1]
+			if !reflect.DeepEqual(fresh, tt.expects) || search.New != len(tt.expects) || search.LastRun.IsZero() {
+				t.Errorf("Test failed - %s\nexpects %v, %d new\nactual  %v, %d new", tt.name, tt.expects, len(tt.expects), fresh, search.New)
+			}
+			if !reflect.DeepEqual(search.Results, tt.links) || !reflect.DeepEqual(s.Saved[0].Results, []string{"x"}) {
+				t.Errorf("Test failed - %s\nexpects results %v\nactual  results %v", tt.name, tt.links, search.Results)
+			}
+		})
+	}
+
+	s := MakeSearchStore()
+	if _, err := s.Update(0, []string{"a"}); err == nil {
+		t.Errorf("Test failed - %s\nexpects %s\nactual  %v", "Unknown saved search", "an error", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// Session is the saved state of the client's tabs, it is
+// written to disk as json
+type Session struct {
+	Tab  int
+	Tabs []SessionTab
+}
+
+// SessionTab is the history of a single tab in a Session
+type SessionTab struct {
+	Position int
+	Pages    []SessionPage
+}
+
+// SessionPage is a single page of history in a SessionTab.
+// The content of the page is kept so that a session can be
+// restored without requesting every page again.
+type SessionPage struct {
+	Location  Url
+	Content   []byte
+	Links     []string
+	FileType  string
+	Scroll    int
+	Security  string
+	Encrypted bool
+}
+
+var validSessionName = regexp.MustCompile(`^[\w\-\.]+$`)
+
+//------------------------------------------------\\
+// + + +           R E C E I V E R S         + + + \\
+//--------------------------------------------------\\
+
+// Write saves the session to the session file with the
+// given name
+func (s Session) Write(name string) error {
+	if !validSessionName.MatchString(name) {
+		return fmt.Errorf("Invalid session name %q, use letters, numbers, '-', '_' or '.'", name)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(sessionDir(), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sessionPath(name), data, 0600)
+}
+
+// Restore rebuilds the tabs stored in the session, wrapping
+// each page to width. It returns the tabs and the index of
+// the tab that was active.
+func (s Session) Restore(width int, color bool) ([]*Pages, int) {
+	tabs := make([]*Pages, 0, len(s.Tabs))
+	for _, t := range s.Tabs {
+		pages := MakePages()
+		for _, sp := range t.Pages {
+			pg := MakePage(sp.Location, string(sp.Content), sp.Links)
+			pg.FileType = sp.FileType
+			pg.Security = sp.Security
+			pg.Encrypted = sp.Encrypted
+			pg.WrapContent(width, color)
+			pg.ScrollPosition = sp.Scroll
+			pages.Add(pg)
+		}
+		// Pages beyond maxPages were shifted off the front
+		pos := t.Position - (len(t.Pages) - pages.Length)
+		if pos >= 0 && pos < pages.Length {
+			pages.Position = pos
+		}
+		tabs = append(tabs, &pages)
+	}
+	tab := s.Tab
+	if tab < 0 || tab >= len(tabs) {
+		tab = 0
+	}
+	return tabs, tab
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// MakeSession returns a Session holding the given tabs
+func MakeSession(tabs []*Pages, tab int) Session {
+	s := Session{tab, make([]SessionTab, 0, len(tabs))}
+	for _, t := range tabs {
+		st := SessionTab{t.Position, make([]SessionPage, 0, t.Length)}
+		for _, pg := range t.History[:t.Length] {
+			st.Pages = append(st.Pages, SessionPage{pg.Location, []byte(pg.RawContent), pg.Links, pg.FileType, pg.ScrollPosition, pg.Security, pg.Encrypted})
+		}
+		s.Tabs = append(s.Tabs, st)
+	}
+	return s
+}
+
+// ReadSession reads the session file with the given name
+func ReadSession(name string) (Session, error) {
+	var s Session
+	if !validSessionName.MatchString(name) {
+		return s, fmt.Errorf("Invalid session name %q, use letters, numbers, '-', '_' or '.'", name)
+	}
+	data, err := ioutil.ReadFile(sessionPath(name))
+	if os.IsNotExist(err) {
+		return s, fmt.Errorf("There is no session named %q", name)
+	} else if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return s, fmt.Errorf("Unable to read session %q: %s", name, err.Error())
+	}
+	if len(s.Tabs) == 0 {
+		return s, fmt.Errorf("Session %q has no tabs", name)
+	}
+	return s, nil
+}
+
+// DeleteSession removes the session file with the given name
+func DeleteSession(name string) error {
+	if !validSessionName.MatchString(name) {
+		return fmt.Errorf("There is no session named %q", name)
+	}
+	err := os.Remove(sessionPath(name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("There is no session named %q", name)
+	}
+	return err
+}
+
+func sessionDir() string {
+	return filepath.Join(bombadillo.Options["configlocation"], ".bombadillo-sessions")
+}
+
+func sessionPath(name string) string {
+	return filepath.Join(sessionDir(), name+".json")
+}
+
+// ListSessions returns the names of the saved sessions, the
+// most recently saved first
+func ListSessions() ([]string, error) {
+	files, err := ioutil.ReadDir(sessionDir())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return []string{}, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".json"))
+		}
+	}
+	return names, nil
+}
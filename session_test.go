@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_Session_Write_Read_Restore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func(c *client) { bombadillo = c }(bombadillo)
+	bombadillo = &client{Options: map[string]string{"configlocation": dir}}
+
+	menu, _ := MakeUrl("gopher://example.org:70/1/")
+	capsule, _ := MakeUrl("gemini://example.org:1965/")
+	next, _ := MakeUrl("gemini://example.org:1965/next")
+	// The second tab is showing the first of its two pages
+	tabs := []*Pages{
+		testTab(SessionPage{menu, []byte("Gopher menu\n"), []string{"gopher://example.org:70/0/about.txt"}, "", 3, "[PLAIN]", false}),
+		testTab(
+			SessionPage{capsule, []byte("# Capsule\n=> /next Next\n"), []string{"gemini://example.org:1965/next"}, "gemini", 1, "[TLS]", true},
+			SessionPage{next, []byte("Next\n"), []string{}, "gemini", 0, "[TLS]", true},
+		),
+	}
+	tabs[1].Position = 0
+
+	err := MakeSession(tabs, 1).Write("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSession("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, tab := s.Restore(80, false)
+
+	if tab != 1 || len(restored) != len(tabs) {
+		t.Fatalf("Test failed - %s\nexpects tab %d of %d\nactual  tab %d of %d", "Tabs are restored", 1, len(tabs), tab, len(restored))
+	}
+	fields := func(pg Page) []interface{} {
+		return []interface{}{pg.Location, pg.RawContent, pg.Links, pg.FileType, pg.ScrollPosition, pg.Security, pg.Encrypted}
+	}
+	for i := range tabs {
+		if restored[i].Position != tabs[i].Position || restored[i].Length != tabs[i].Length {
+			t.Errorf("Test failed - %s\nexpects page %d of %d\nactual  page %d of %d", "Tab position is restored", tabs[i].Position, tabs[i].Length, restored[i].Position, restored[i].Length)
+			continue
+		}
+		for j := 0; j < tabs[i].Length; j++ {
+			expects, actual := fields(tabs[i].History[j]), fields(restored[i].History[j])
+			if !reflect.DeepEqual(actual, expects) {
+				t.Errorf("Test failed - %s\nexpects %v\nactual  %v", "Page is restored", expects, actual)
+			}
+		}
+	}
+}
+
+func Test_ReadSession_Errors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func(c *client) { bombadillo = c }(bombadillo)
+	bombadillo = &client{Options: map[string]string{"configlocation": dir}}
+
+	err := Session{0, []SessionTab{}}.Write("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		session string
+	}{
+		{"Session with no tabs", "empty"},
+		{"Session that was never saved", "missing"},
+		{"Name that is not a file name", "../empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadSession(tt.session)
+			if err == nil {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %v", tt.name, "an error", err)
+			}
+		})
+	}
+}
+
+// testTab returns a tab holding the given pages, showing the
+// last of them
+func testTab(pages ...SessionPage) *Pages {
+	out := MakePages()
+	for _, sp := range pages {
+		pg := MakePage(sp.Location, string(sp.Content), sp.Links)
+		pg.FileType = sp.FileType
+		pg.ScrollPosition = sp.Scroll
+		pg.Security = sp.Security
+		pg.Encrypted = sp.Encrypted
+		out.Add(pg)
+	}
+	return &out
+}
@@ -0,0 +1,205 @@
+// Package spartan retrieves documents with the spartan protocol.
+// Spartan is close to gemini, and shares its document format,
+// but is sent without TLS and takes input as the body of the
+// request rather than as the query of its url.
+package spartan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tildegit.org/sloum/bombadillo/gemini"
+	"tildegit.org/sloum/bombadillo/stream"
+)
+
+//------------------------------------------------\\
+// + + +             T Y P E S               + + + \\
+//--------------------------------------------------\\
+
+// Response is a parsed spartan response. The status is the
+// single digit sent by the server. For redirects Content holds
+// the url being redirected to.
+type Response struct {
+	Status  int
+	MimeMaj string
+	MimeMin string
+	Content string
+	Links   []string
+}
+
+var statusMessages = map[int]string{
+	2: "Success",
+	3: "Redirect",
+	4: "Client Error",
+	5: "Server Error",
+}
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// Retrieve requests resource from host, sending data as the
+// body of the request, and returns the raw response
+func Retrieve(ctx context.Context, host, port, resource string, data []byte) ([]byte, error) {
+	conn, err := request(ctx, host, port, resource, data)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	return stream.ReadAll(ctx, conn)
+}
+
+// Download makes a request and, if the response is successful,
+// writes the body to w as it is received
+func Download(ctx context.Context, host, port, resource string, data []byte, w io.Writer) error {
+	conn, err := request(ctx, host, port, resource, data)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Invalid response from server")
+	}
+	status, meta, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case 2:
+		_, err = stream.Copy(ctx, w, reader)
+		return err
+	case 3:
+		return fmt.Errorf("[3] Redirects cannot be saved.")
+	default:
+		return errors.New(StatusMessage(status, meta))
+	}
+}
+
+// Parse builds a Response from a raw response to a request
+// for resource from host and port. Gemtext documents have
+// their '=:' lines made into links that prompt for input.
+func Parse(raw []byte, host, port, resource string) (Response, error) {
+	var out Response
+	resp := strings.SplitN(string(raw), "\n", 2)
+	if len(resp) != 2 {
+		return out, fmt.Errorf("Invalid response from server")
+	}
+	status, meta, err := parseHeader(resp[0])
+	if err != nil {
+		return out, err
+	}
+	out.Status = status
+
+	switch status {
+	case 2:
+		mime := strings.TrimSpace(strings.Split(meta, ";")[0])
+		if mime == "" {
+			mime = "text/gemini"
+		}
+		majMin := strings.Split(mime, "/")
+		if len(majMin) < 2 {
+			return out, fmt.Errorf("Improperly formatted mimetype received from server")
+		}
+		out.MimeMaj, out.MimeMin = majMin[0], majMin[1]
+		if out.MimeMaj == "text" && out.MimeMin == "gemini" {
+			currentUrl := fmt.Sprintf("spartan://%s%s", net.JoinHostPort(host, port), path(resource))
+			out.Content, out.Links = gemini.ParseGemtext(resp[1], currentUrl, true)
+		} else {
+			out.Content = resp[1]
+		}
+		return out, nil
+	case 3:
+		// Redirects are to a path on the same host
+		out.Content = fmt.Sprintf("spartan://%s%s", net.JoinHostPort(host, port), path(meta))
+		return out, nil
+	default:
+		return out, errors.New(StatusMessage(status, meta))
+	}
+}
+
+// SplitQuery separates the path of a spartan resource from
+// its query. The unescaped query is the data to upload.
+func SplitQuery(resource string) (string, []byte) {
+	ind := strings.Index(resource, "?")
+	if ind < 0 {
+		return resource, []byte{}
+	}
+	query, err := url.PathUnescape(resource[ind+1:])
+	if err != nil {
+		query = resource[ind+1:]
+	}
+	return resource[:ind], []byte(query)
+}
+
+// StatusMessage returns a human readable description of a
+// status, including the meta sent by the server
+func StatusMessage(status int, meta string) string {
+	msg, ok := statusMessages[status]
+	if !ok {
+		msg = "Invalid response status from server"
+	}
+	if meta != "" {
+		return fmt.Sprintf("[%d] %s: %s", status, msg, meta)
+	}
+	return fmt.Sprintf("[%d] %s", status, msg)
+}
+
+func request(ctx context.Context, host, port, resource string, data []byte) (net.Conn, error) {
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Incomplete request url")
+	}
+	dialer := net.Dialer{Timeout: time.Duration(5) * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	send := fmt.Sprintf("%s %s %d\r\n", host, path(resource), len(data))
+	_, err = conn.Write(append([]byte(send), data...))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// parseHeader splits a response header into its status digit
+// and meta
+func parseHeader(header string) (int, string, error) {
+	header = strings.TrimRight(header, "\r\n")
+	split := strings.SplitN(header, " ", 2)
+	if len(split[0]) != 1 {
+		return 0, "", fmt.Errorf("Invalid response format from server")
+	}
+	status, err := strconv.Atoi(split[0])
+	if err != nil || status < 2 || status > 5 {
+		return 0, "", fmt.Errorf("Invalid status response from server")
+	}
+	var meta string
+	if len(split) > 1 {
+		meta = strings.TrimSpace(split[1])
+	}
+	return status, meta, nil
+}
+
+// path returns resource as an absolute path
+func path(resource string) string {
+	if !strings.HasPrefix(resource, "/") {
+		return "/" + resource
+	}
+	return resource
+}
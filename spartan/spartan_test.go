@@ -0,0 +1,120 @@
+package spartan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		status int
+		meta   string
+		fails  bool
+	}{
+		{"Success with a mime type", "2 text/gemini\r\n", 2, "text/gemini", false},
+		{"Success without a mime type", "2\r\n", 2, "", false},
+		{"Redirect", "3 /new/path\n", 3, "/new/path", false},
+		{"Server error with a message", "5 Something  broke \r\n", 5, "Something  broke", false},
+		{"Gemini style two digit status", "20 text/gemini\r\n", 0, "", true},
+		{"Status out of range", "1 prompt\r\n", 0, "", true},
+		{"Status that is not a number", "x text/gemini\r\n", 0, "", true},
+		{"Empty header", "\r\n", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, meta, err := parseHeader(tt.input)
+			if status != tt.status || meta != tt.meta || (err != nil) != tt.fails {
+				t.Errorf("Test failed - %s\nexpects %d %q, error %t\nactual  %d %q, error %v", tt.name, tt.status, tt.meta, tt.fails, status, meta, err)
+			}
+		})
+	}
+}
+
+func Test_SplitQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		resource string
+		data     string
+	}{
+		{"No query", "/guestbook", "/guestbook", ""},
+		{"Empty query", "/guestbook?", "/guestbook", ""},
+		{"Escaped query", "/guestbook?hello%20there%3F", "/guestbook", "hello there?"},
+		{"Query holding a second '?'", "/search?a?b", "/search", "a?b"},
+		{"Query that is not validly escaped", "/search?100%", "/search", "100%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, data := SplitQuery(tt.input)
+			if resource != tt.resource || string(data) != tt.data {
+				t.Errorf("Test failed - %s\nexpects %s %q\nactual  %s %q", tt.name, tt.resource, tt.data, resource, data)
+			}
+		})
+	}
+}
+
+func Test_Parse_Input_Links(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects []string
+	}{
+		{
+			"Input link with a path",
+			"=: /guestbook Sign the guestbook\n",
+			[]string{"spartan://example.org:300/guestbook?"},
+		},
+		{
+			"Input link loses its query",
+			"=: /search?old Search\n",
+			[]string{"spartan://example.org:300/search?"},
+		},
+		{
+			"Input link with no description",
+			"=: spartan://other.example/post\n",
+			[]string{"spartan://other.example/post?"},
+		},
+		{
+			"Normal links are unchanged",
+			"=> /about.gmi About\n=: /post Post\n",
+			[]string{"spartan://example.org:300/about.gmi", "spartan://example.org:300/post?"},
+		},
+		{
+			"Input link in a preformatted block",
+			"```\n=: /post Post\n```\n",
+			[]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Parse([]byte("2 text/gemini\r\n"+tt.input), "example.org", "300", "/")
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s", tt.name, err)
+			}
+			if !reflect.DeepEqual(resp.Links, tt.expects) {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %s", tt.name, tt.expects, resp.Links)
+			}
+		})
+	}
+}
+
+func Test_Parse_Status_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expects string
+	}{
+		{"Server error", "5 Out of disk\r\n", StatusMessage(5, "Out of disk")},
+		{"Message holding '%'", "4 100%s not found\r\n", StatusMessage(4, "100%s not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input), "example.org", "300", "/")
+			if err == nil || err.Error() != tt.expects {
+				t.Errorf("Test failed - %s\nexpects %s\nactual  %v", tt.name, tt.expects, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package stream provides the size limited, progress reporting
+// reads shared by the protocol packages when receiving responses
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+//------------------------------------------------\\
+// + + +          V A R I A B L E S          + + + \\
+//--------------------------------------------------\\
+
+// Reporter is called periodically while a response is read
+// with the number of bytes received so far and the current rate
+// of transfer in bytes per second
+type Reporter func(received int64, rate float64)
+
+type progressKey struct{}
+
+type maxSizeKey struct{}
+
+var progressInterval time.Duration = 250 * time.Millisecond
+
+//------------------------------------------------\\
+// + + +          F U N C T I O N S          + + + \\
+//--------------------------------------------------\\
+
+// WithProgress returns a copy of ctx that has reads made with
+// it report on their progress to fn
+func WithProgress(ctx context.Context, fn Reporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// WithMaxSize returns a copy of ctx that has reads made with
+// it give up on responses larger than size bytes. A size less
+// than 1 means no limit.
+func WithMaxSize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, maxSizeKey{}, size)
+}
+
+// ReadAll reads from r until EOF and returns the data read. An
+// error is returned if the data exceeds the size set on ctx with
+// WithMaxSize.
+func ReadAll(ctx context.Context, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	limit, _ := ctx.Value(maxSizeKey{}).(int64)
+	_, err := copyLimit(ctx, &buf, r, limit)
+	if err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Copy writes the data read from r to w until EOF, reporting on
+// progress as it goes. It returns the number of bytes written and
+// an error if one occurs. Copies are not held to a maximum size,
+// as the data is not kept in memory.
+func Copy(ctx context.Context, w io.Writer, r io.Reader) (int64, error) {
+	return copyLimit(ctx, w, r, 0)
+}
+
+func copyLimit(ctx context.Context, w io.Writer, r io.Reader, limit int64) (int64, error) {
+	progress, _ := ctx.Value(progressKey{}).(Reporter)
+	buf := make([]byte, 32*1024)
+	var total int64
+	start := time.Now()
+	last := start
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if limit > 0 && total+int64(n) > limit {
+				return total, fmt.Errorf("Response is larger than the maximum size of %s, see the 'maxbodysize' setting", FormatSize(limit))
+			}
+			written, werr := w.Write(buf[:n])
+			total += int64(written)
+			if werr != nil {
+				return total, werr
+			}
+			if now := time.Now(); progress != nil && now.Sub(last) >= progressInterval {
+				last = now
+				progress(total, float64(total)/now.Sub(start).Seconds())
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// CloseOnCancel closes c if ctx is cancelled before the returned
+// function is called. Closing the connection interrupts any read
+// that is blocked on it.
+func CloseOnCancel(ctx context.Context, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// FormatSize returns a human readable representation of a
+// number of bytes
+func FormatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
@@ -48,8 +48,17 @@ func setTermios(termios syscall.Termios) {
 
 func SetCharMode() {
 	t := getTermios()
-	t.Lflag = t.Lflag ^ syscall.ICANON
-	t.Lflag = t.Lflag ^ syscall.ECHO
+	t.Lflag = t.Lflag &^ syscall.ICANON
+	t.Lflag = t.Lflag &^ syscall.ECHO
+	setTermios(t)
+}
+
+// SetSecretMode switches to line based input without
+// echoing the typed characters to the screen
+func SetSecretMode() {
+	t := getTermios()
+	t.Lflag = t.Lflag | syscall.ICANON
+	t.Lflag = t.Lflag &^ syscall.ECHO
 	setTermios(t)
 }
 
@@ -58,3 +67,18 @@ func SetLineMode() {
 	t.Lflag = t.Lflag | (syscall.ICANON | syscall.ECHO)
 	setTermios(t)
 }
+
+// SetReadTimeout makes reads from the terminal give up after
+// the given number of tenths of a second if no input arrives.
+// A value of zero restores reads that block until input arrives.
+func SetReadTimeout(tenths uint8) {
+	t := getTermios()
+	if tenths == 0 {
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+	} else {
+		t.Cc[syscall.VMIN] = 0
+		t.Cc[syscall.VTIME] = tenths
+	}
+	setTermios(t)
+}
@@ -0,0 +1,65 @@
+// Package titan uploads to capsules with the titan protocol,
+// the upload companion to gemini. Connections are made, and
+// server certificates trusted, exactly as they are for gemini.
+package titan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"tildegit.org/sloum/bombadillo/gemini"
+	"tildegit.org/sloum/bombadillo/stream"
+)
+
+// Upload sends size bytes read from body to resource on host,
+// along with their mime type and, if it is not empty, the
+// token that the capsule requires for uploads. It returns the
+// raw response, which takes the same form as a gemini one.
+func Upload(ctx context.Context, host, port, resource string, body io.Reader, size int64, mime, token string, td *gemini.TofuDigest, ids *gemini.IdentityStore) (string, error) {
+	conn, err := gemini.Dial(ctx, host, port, resource, td, ids)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	defer stream.CloseOnCancel(ctx, conn)()
+
+	send := RequestUrl(host, port, resource, size, mime, token) + "\r\n"
+	_, err = conn.Write([]byte(send))
+	if err != nil {
+		return "", err
+	}
+
+	n, err := io.CopyN(conn, body, size)
+	if err != nil {
+		return "", fmt.Errorf("Upload failed after %d of %d bytes: %s", n, size, err.Error())
+	}
+
+	resp, err := stream.ReadAll(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// RequestUrl returns the titan url for an upload of size bytes
+// to resource, with its parameters
+func RequestUrl(host, port, resource string, size int64, mime, token string) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("titan://%s/%s;size=%d", net.JoinHostPort(host, port), resource, size))
+	if mime != "" {
+		out.WriteString(";mime=" + escapeParam(mime))
+	}
+	if token != "" {
+		out.WriteString(";token=" + escapeParam(token))
+	}
+	return out.String()
+}
+
+// escapeParam percent encodes the characters that would end
+// a parameter value early
+func escapeParam(value string) string {
+	return strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", " ", "%20").Replace(value)
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os/user"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"tildegit.org/sloum/bombadillo/idn"
+	"tildegit.org/sloum/bombadillo/nex"
 )
 
 //------------------------------------------------\\
@@ -17,6 +21,9 @@ import (
 // built-in url library so-as to support gopher URLs, as
 // well as track mime-type and renderability (can the
 // response to the url be rendered as text in the client).
+// Host is kept in the form used to connect to it: IPv6
+// addresses without their brackets and internationalized
+// names in punycode.
 type Url struct {
 	Scheme       string
 	Host         string
@@ -49,6 +56,10 @@ func MakeUrl(u string) (Url, error) {
 		return parseFinger(u)
 	}
 
+	if strings.HasPrefix(u, "about:") {
+		return Url{Scheme: "about", Resource: u[6:], Full: u}, nil
+	}
+
 	var out Url
 	if local := strings.HasPrefix(u, "local://"); u[0] == '/' || u[0] == '.' || u[0] == '~' || local {
 		if local && len(u) > 8 {
@@ -75,7 +86,7 @@ func MakeUrl(u string) (Url, error) {
 		return out, nil
 	}
 
-	re := regexp.MustCompile(`^((?P<scheme>[a-zA-Z]+):\/\/)?(?P<host>[\w\-\.\d]+)(?::(?P<port>\d+)?)?(?:/(?P<type>[01345679gIhisp])?)?(?P<resource>.*)?$`)
+	re := regexp.MustCompile(`^((?P<scheme>[a-zA-Z]+):\/\/)?(?P<host>\[[^\]\s/]*\]|(?:[\w\-\.]|[^\x00-\x7F])+)(?::(?P<port>\d+)?)?(?:/(?P<type>[01345679gIhisp])?)?(?P<resource>.*)?$`)
 	match := re.FindStringSubmatch(u)
 
 	if valid := re.MatchString(u); !valid {
@@ -100,6 +111,11 @@ func MakeUrl(u string) (Url, error) {
 	if out.Host == "" {
 		return out, fmt.Errorf("no host")
 	}
+	host, err := normalizeHost(out.Host)
+	if err != nil {
+		return out, err
+	}
+	out.Host = host
 
 	out.Scheme = strings.ToLower(out.Scheme)
 
@@ -107,19 +123,25 @@ func MakeUrl(u string) (Url, error) {
 		out.Scheme = bombadillo.Options["defaultscheme"]
 	}
 
-	if out.Scheme == "gopher" && out.Port == "" {
+	if (out.Scheme == "gopher" || out.Scheme == "gophers") && out.Port == "" {
 		out.Port = "70"
 	} else if out.Scheme == "http" && out.Port == "" {
 		out.Port = "80"
 	} else if out.Scheme == "https" && out.Port == "" {
 		out.Port = "443"
-	} else if out.Scheme == "gemini" && out.Port == "" {
+	} else if (out.Scheme == "gemini" || out.Scheme == "titan") && out.Port == "" {
 		out.Port = "1965"
 	} else if out.Scheme == "telnet" && out.Port == "" {
 		out.Port = "23"
+	} else if out.Scheme == "spartan" && out.Port == "" {
+		out.Port = "300"
+	} else if out.Scheme == "nex" && out.Port == "" {
+		out.Port = "1900"
+	} else if out.Scheme == "cso" && out.Port == "" {
+		out.Port = "105"
 	}
 
-	if out.Scheme == "gopher" {
+	if out.Scheme == "gopher" || out.Scheme == "gophers" {
 		if out.Mime == "" {
 			out.Mime = "1"
 		}
@@ -130,7 +152,7 @@ func MakeUrl(u string) (Url, error) {
 			out.Mime = "1"
 		}
 		switch out.Mime {
-		case "1", "0", "h", "7", "I", "g":
+		case "1", "0", "2", "h", "7", "I", "g":
 			out.DownloadOnly = false
 		default:
 			out.DownloadOnly = true
@@ -138,9 +160,12 @@ func MakeUrl(u string) (Url, error) {
 	} else {
 		out.Resource = fmt.Sprintf("%s%s", out.Mime, out.Resource)
 		out.Mime = ""
+		if out.Scheme == "nex" {
+			out.DownloadOnly = !nex.IsText(out.Resource)
+		}
 	}
 
-	out.Full = out.Scheme + "://" + out.Host + ":" + out.Port + "/" + out.Mime + out.Resource
+	out.Full = out.Scheme + "://" + hostPort(out.Host, out.Port) + "/" + out.Mime + out.Resource
 
 	return out, nil
 }
@@ -157,17 +182,47 @@ func parseFinger(u string) (Url, error) {
 		out.Resource = userPlusAddress[0]
 		u = userPlusAddress[1]
 	}
-	hostPort := strings.Split(u, ":")
-	if len(hostPort) < 2 {
-		out.Port = "79"
-	} else {
-		out.Port = hostPort[1]
+	out.Host, out.Port = u, "79"
+	if host, port, err := net.SplitHostPort(u); err == nil {
+		out.Host, out.Port = host, port
 	}
-	out.Host = hostPort[0]
+	host, err := normalizeHost(out.Host)
+	if err != nil {
+		return out, err
+	}
+	out.Host = host
 	resource := ""
 	if out.Resource != "" {
 		resource = out.Resource + "@"
 	}
-	out.Full = fmt.Sprintf("%s://%s%s:%s", out.Scheme, resource, out.Host, out.Port)
+	out.Full = fmt.Sprintf("%s://%s%s", out.Scheme, resource, hostPort(out.Host, out.Port))
 	return out, nil
 }
+
+// normalizeHost returns a host taken from a url in the form
+// used to connect to it. IPv6 addresses lose their brackets
+// and have any zone unescaped, other hosts are converted to
+// punycode if they are internationalized.
+func normalizeHost(host string) (string, error) {
+	bracketed := strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]")
+	if bracketed {
+		host = host[1 : len(host)-1]
+	}
+	if !strings.Contains(host, ":") && !bracketed {
+		return idn.ToASCII(host)
+	}
+	addr, zone := host, ""
+	if i := strings.Index(host, "%"); i >= 0 {
+		addr, zone = host[:i], "%"+strings.TrimPrefix(host[i+1:], "25")
+	}
+	if net.ParseIP(addr) == nil || !strings.Contains(addr, ":") || zone == "%" {
+		return "", fmt.Errorf("Invalid IPv6 address %q", host)
+	}
+	return strings.ToLower(addr) + zone, nil
+}
+
+// hostPort joins host and port for use in a url, putting IPv6
+// addresses in brackets and escaping their zone
+func hostPort(host, port string) string {
+	return net.JoinHostPort(strings.Replace(host, "%", "%25", 1), port)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_MakeUrl_Round_Trip(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		host   string
+		port   string
+		expect string
+	}{
+		{
+			"Gopher with a hostname",
+			"gopher://example.org/1/phlog",
+			"example.org",
+			"70",
+			"gopher://example.org:70/1/phlog",
+		},
+		{
+			"Gopher with an IPv6 address and port",
+			"gopher://[2001:DB8::1]:7070/0/about.txt",
+			"2001:db8::1",
+			"7070",
+			"gopher://[2001:db8::1]:7070/0/about.txt",
+		},
+		{
+			"Gopher search with an IPv6 address",
+			"gopher://[2001:db8::1]/7/search\tterms",
+			"2001:db8::1",
+			"70",
+			"gopher://[2001:db8::1]:70/1/search\tterms",
+		},
+		{
+			"Gophers with an internationalized name",
+			"gophers://bücher.example/1/",
+			"xn--bcher-kva.example",
+			"70",
+			"gophers://xn--bcher-kva.example:70/1/",
+		},
+		{
+			"Gemini with an IPv6 address",
+			"gemini://[::1]/index.gmi",
+			"::1",
+			"1965",
+			"gemini://[::1]:1965/index.gmi",
+		},
+		{
+			"Gemini with an internationalized name",
+			"gemini://München.example:1966/wiki?query",
+			"xn--mnchen-3ya.example",
+			"1966",
+			"gemini://xn--mnchen-3ya.example:1966/wiki?query",
+		},
+		{
+			"Gemini with a name in punycode",
+			"gemini://xn--mnchen-3ya.example/",
+			"xn--mnchen-3ya.example",
+			"1965",
+			"gemini://xn--mnchen-3ya.example:1965/",
+		},
+		{
+			"Titan with an IPv6 address",
+			"titan://[2001:db8::2]/upload;size=10",
+			"2001:db8::2",
+			"1965",
+			"titan://[2001:db8::2]:1965/upload;size=10",
+		},
+		{
+			"Http with an internationalized name",
+			"http://例え.テスト/wiki",
+			"xn--r8jz45g.xn--zckzah",
+			"80",
+			"http://xn--r8jz45g.xn--zckzah:80/wiki",
+		},
+		{
+			"Https with an IPv6 address and zone",
+			"https://[fe80::1%25eth0]:8443/",
+			"fe80::1%eth0",
+			"8443",
+			"https://[fe80::1%25eth0]:8443/",
+		},
+		{
+			"Telnet with an IPv6 address",
+			"telnet://[2001:db8::3]",
+			"2001:db8::3",
+			"23",
+			"telnet://[2001:db8::3]:23/",
+		},
+		{
+			"Spartan with an IPv4 address",
+			"spartan://192.0.2.1/",
+			"192.0.2.1",
+			"300",
+			"spartan://192.0.2.1:300/",
+		},
+		{
+			"Nex with an internationalized name",
+			"nex://bücher.example/docs/",
+			"xn--bcher-kva.example",
+			"1900",
+			"nex://xn--bcher-kva.example:1900/docs/",
+		},
+		{
+			"Cso with an IPv6 address",
+			"cso://[2001:db8::4]?name=smith",
+			"2001:db8::4",
+			"105",
+			"cso://[2001:db8::4]:105/?name=smith",
+		},
+		{
+			"Finger with an IPv6 address",
+			"finger://user@[2001:db8::5]",
+			"2001:db8::5",
+			"79",
+			"finger://user@[2001:db8::5]:79",
+		},
+		{
+			"Finger with an internationalized name and port",
+			"finger://bücher.example:7979",
+			"xn--bcher-kva.example",
+			"7979",
+			"finger://xn--bcher-kva.example:7979",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := MakeUrl(tt.input)
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s", tt.name, err)
+			}
+			if u.Host != tt.host || u.Port != tt.port || u.Full != tt.expect {
+				t.Errorf("Test failed - %s\nexpects %s %s %s\nactual  %s %s %s", tt.name, tt.host, tt.port, tt.expect, u.Host, u.Port, u.Full)
+			}
+			again, err := MakeUrl(u.Full)
+			if err != nil {
+				t.Fatalf("Test failed - %s\nunexpected error %s parsing %s", tt.name, err, u.Full)
+			}
+			if !reflect.DeepEqual(u, again) {
+				t.Errorf("Test failed - %s\nexpects %+v\nactual  %+v", tt.name, u, again)
+			}
+		})
+	}
+}
+
+func Test_MakeUrl_Invalid_Hosts(t *testing.T) {
+	tests := []string{
+		"gopher://[2001:db8::zz]/",
+		"gemini://[192.0.2.1]/",
+		"gemini://[::1%25]/",
+	}
+	for _, input := range tests {
+		if u, err := MakeUrl(input); err == nil {
+			t.Errorf("Test failed - %s\nexpects an error\nactual  %+v", input, u)
+		}
+	}
+}